@@ -5,16 +5,17 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"reflect"
-	"runtime"
-	"strings"
+	"net/http"
+	"os"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	pb "github.com/cortexapps/axon-go/.generated/proto/github.com/cortexapps/axon"
 	"github.com/cortexapps/axon-go/version"
 
 	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 	"google.golang.org/grpc"
@@ -30,12 +31,53 @@ type Agent struct {
 
 	client grpcClient
 
+	endpoints         []endpoint
+	endpointMode      EndpointMode
+	activeEndpoint    int
+	failedEndpoints   int
+	clientMu          sync.RWMutex
+	recentInvocations *recentInvocations
+
 	handlers           []*handlerInfo
 	registeredHandlers map[string]*handlerInfo
-
-	logger       *zap.Logger
-	sleepOnError time.Duration
-	done         chan struct{}
+	registeredWith     map[string]grpcClient
+	staleRegistrations map[string]grpcClient
+	handlersMu         sync.Mutex
+	leaderElection     *leaderElection
+	middleware         []Middleware
+	metrics            Metrics
+	tracer             trace.Tracer
+
+	health             HealthConfig
+	handlersRegistered atomic.Bool
+	lastMessage        atomic.Int64
+	gaveUp             atomic.Bool
+	healthServer       *http.Server
+	keepHealth         func() bool
+	healthMu           sync.Mutex
+
+	logger        *zap.Logger
+	logLimits     LogLimits
+	sleepOnError  time.Duration
+	resultEncoder ResultEncoder
+	scheduler     *scheduler
+	backoff       BackoffPolicy
+	done          chan struct{}
+
+	state      ConnectionState
+	stateMu    sync.Mutex
+	stateHooks []ConnectionStateHook
+
+	runningHandlers  sync.WaitGroup
+	inFlight         map[*invocation]struct{}
+	inFlightMu       sync.Mutex
+	stopCtx          context.Context
+	stopAgent        context.CancelFunc
+	abortCtx         context.Context
+	abortAgent       context.CancelFunc
+	unregisterOnStop bool
+	shutdownSignals  []os.Signal
+	shutdownTimeout  time.Duration
 }
 
 // NewAxonAgent creates a new AxonAgent with the specified options.  You
@@ -54,27 +96,78 @@ func NewAxonAgent(options ...Option) *Agent {
 	}
 
 	a := &Agent{
-		DispatchId:   uuid.New().String(),
-		logger:       logger,
-		sleepOnError: ao.sleepOnError,
-		done:         make(chan struct{}),
+		DispatchId:    uuid.New().String(),
+		logger:        logger,
+		logLimits:     ao.logLimits,
+		sleepOnError:  ao.sleepOnError,
+		resultEncoder: ao.resultEncoder,
+		scheduler:     newScheduler(newConcurrencyPool(ao.maxConcurrency, ao.queueDepth, ao.overflowPolicy)),
+		backoff:       ao.backoff,
+		done:          make(chan struct{}),
+		stateHooks:    ao.stateHooks,
+
+		inFlight:         make(map[*invocation]struct{}),
+		unregisterOnStop: ao.unregisterOnStop,
+		shutdownSignals:  ao.shutdownSignals,
+		shutdownTimeout:  ao.shutdownTimeout,
 	}
+	a.stopCtx, a.stopAgent = context.WithCancel(context.Background())
+	// abortCtx ends when Stop gives up waiting for handlers, ending the retries of
+	// any reports still in progress
+	a.abortCtx, a.abortAgent = context.WithCancel(context.Background())
 
 	a.logger = logger
-	a.client = newGrpcClient(ao.host, ao.port, logger)
+
+	a.tracer = newTracer(ao.tracerProvider)
+	dialOptions := append([]grpc.DialOption{
+		grpc.WithChainUnaryInterceptor(propagationInterceptor(ao.propagator)),
+	}, ao.dialOptions...)
+
+	targets := ao.endpoints
+	if len(targets) == 0 {
+		targets = []string{ao.target}
+	}
+	for _, target := range targets {
+		a.endpoints = append(a.endpoints, endpoint{
+			target: target,
+			client: newGrpcClient(target, ao.tlsConfig, dialOptions, logger),
+		})
+	}
+	a.endpointMode = ao.endpointMode
+	a.client = a.endpoints[0].client
+	a.recentInvocations = newRecentInvocations(recentInvocationsSize)
+	a.metrics = ao.metrics
+	a.health = ao.health
+	a.handlersRegistered.Store(true)
+	if ao.locker != nil {
+		a.leaderElection = &leaderElection{
+			locker:        ao.locker,
+			leaseDuration: ao.leaseDuration,
+		}
+	}
+
 	a.registeredHandlers = make(map[string]*handlerInfo)
+	a.registeredWith = make(map[string]grpcClient)
+	a.staleRegistrations = make(map[string]grpcClient)
 	return a
 }
 
-func (a *Agent) getHandlerName(handler any) string {
-	name := runtime.FuncForPC(reflect.ValueOf(handler).Pointer()).Name()
-	parts := strings.Split(name, ".")
-	return parts[len(parts)-1]
-}
-
 type registerHandlerOptions struct {
+	name           string
+	namespace      string
 	timeout        time.Duration
 	handlerOptions []*pb.HandlerOption
+	maxConcurrency int
+	queueDepth     int
+	overflowPolicy OverflowPolicy
+	singleton      *SingletonMode
+	middleware     []Middleware
+}
+
+func defaultRegisterHandlerOptions() *registerHandlerOptions {
+	return &registerHandlerOptions{
+		queueDepth: -1,
+	}
 }
 
 type RegisterHandlerOption func(*registerHandlerOptions)
@@ -85,6 +178,60 @@ func WithTimeout(timeout time.Duration) RegisterHandlerOption {
 	}
 }
 
+// WithMaxConcurrency limits how many invocations of the handler can run at
+// once, further invocations are queued until a running one finishes
+func WithMaxConcurrency(limit int) RegisterHandlerOption {
+	return func(o *registerHandlerOptions) {
+		o.maxConcurrency = limit
+	}
+}
+
+// WithQueue bounds the number of invocations of the handler that can wait for
+// a concurrency slot, applying policy when the queue is full.  By default the
+// queue is unbounded.
+func WithQueue(depth int, policy OverflowPolicy) RegisterHandlerOption {
+	return func(o *registerHandlerOptions) {
+		o.queueDepth = depth
+		o.overflowPolicy = policy
+	}
+}
+
+// SingletonMode controls what happens to an invocation of a singleton handler
+// that arrives while it is already running
+type SingletonMode int
+
+const (
+	// SingletonSkip skips the invocation
+	SingletonSkip SingletonMode = iota
+	// SingletonQueueOne runs the invocation once the running one finishes,
+	// skipping any more that arrive while it waits
+	SingletonQueueOne
+)
+
+// WithSingleton guarantees at most one invocation of the handler runs at a time,
+// which stops interval and cron handlers overlapping when a run takes longer
+// than the schedule.  Skipped invocations are reported with ErrorCodeSkipped.
+func WithSingleton(mode SingletonMode) RegisterHandlerOption {
+	return func(o *registerHandlerOptions) {
+		o.singleton = &mode
+	}
+}
+
+// WithName sets the name the handler is registered with, rather than deriving
+// it from the handler function
+func WithName(name string) RegisterHandlerOption {
+	return func(o *registerHandlerOptions) {
+		o.name = name
+	}
+}
+
+// WithNamespace prefixes the handler name with namespace, e.g. "billing.sync"
+func WithNamespace(namespace string) RegisterHandlerOption {
+	return func(o *registerHandlerOptions) {
+		o.namespace = namespace
+	}
+}
+
 func WithInvokeOption(invokeType pb.HandlerInvokeType, value string) RegisterHandlerOption {
 	return func(o *registerHandlerOptions) {
 		o.handlerOptions = append(o.handlerOptions,
@@ -104,135 +251,326 @@ type Handler = func(HandlerContext) error
 type InvocableHandler = func(HandlerContext) (any, error)
 
 type handlerInfo struct {
+	// id is returned by RegisterHandler and stays the same as the handler's
+	// registrations change
+	id         string
 	dispatchId string
 	name       string
+	pkg        string
+	symbol     string
 	options    []*pb.HandlerOption
 	handler    any
 	timeout    time.Duration
+	pool       *concurrencyPool
+	middleware []Middleware
 }
 
 // RegisterHandler registeres a handler to be invoked with the specified options.  It
-// returns the id of the handler which can be used to unregister it
+// returns the id of the handler which can be used to unregister it, which stays valid
+// when the handler is registered again after reconnecting or a change of leader.
 func (a *Agent) RegisterHandler(handler Handler, invokeOptions ...RegisterHandlerOption) (string, error) {
 
-	name := a.getHandlerName(handler)
+	opts := defaultRegisterHandlerOptions()
 
-	for _, h := range a.handlers {
-		if h.name == name {
-			return "", fmt.Errorf("handler %s already registered", name)
-		}
+	for _, opt := range invokeOptions {
+		opt(opts)
 	}
 
-	opts := &registerHandlerOptions{}
+	return a.addHandler(handler, handler, opts)
+}
+
+// RegisterInvocableHandler registers a handler that returns a result, which is
+// encoded and reported to the agent for every invocation regardless of how it
+// was triggered
+func (a *Agent) RegisterInvocableHandler(handler InvocableHandler, invokeOptions ...RegisterHandlerOption) (string, error) {
+	return a.registerInvocableHandler(handler, handler, invokeOptions...)
+}
+
+// registerInvocableHandler registers handler, naming it after fn which is the
+// function supplied by the caller
+func (a *Agent) registerInvocableHandler(fn any, handler InvocableHandler, invokeOptions ...RegisterHandlerOption) (string, error) {
+
+	opts := defaultRegisterHandlerOptions()
 
 	for _, opt := range invokeOptions {
 		opt(opts)
 	}
 
-	info := &handlerInfo{
-		dispatchId: a.DispatchId,
-		name:       name,
-		options:    opts.handlerOptions,
-		handler:    handler,
-		timeout:    opts.timeout,
-	}
-	a.handlers = append(a.handlers, info)
-	return a.registerHandler(info)
+	return a.addHandler(fn, handler, opts)
 }
 
-func (a *Agent) RegisterInvocableHandler(handler InvocableHandler, invokeOptions ...RegisterHandlerOption) (string, error) {
+func (a *Agent) addHandler(fn any, handler any, opts *registerHandlerOptions) (string, error) {
 
-	name := a.getHandlerName(handler)
+	pkg, name, symbol, err := resolveHandlerName(fn, opts)
+	if err != nil {
+		return "", err
+	}
 
-	for _, h := range a.handlers {
-		if h.name == name {
-			return "", fmt.Errorf("handler %s already registered", name)
-		}
+	if err := validateInvokeOptions(opts.handlerOptions); err != nil {
+		return "", fmt.Errorf("invalid options for handler %s: %w", name, err)
+	}
+
+	pool, err := newHandlerPool(opts)
+	if err != nil {
+		return "", fmt.Errorf("invalid options for handler %s: %w", name, err)
 	}
 
-	opts := &registerHandlerOptions{}
+	a.handlersMu.Lock()
+	defer a.handlersMu.Unlock()
 
-	for _, opt := range invokeOptions {
-		opt(opts)
+	for _, h := range a.handlers {
+		if h.name != name {
+			continue
+		}
+		if h.pkg != pkg && h.pkg != "" && pkg != "" {
+			return "", fmt.Errorf("handler %s is registered by both %s and %s, use WithName or WithNamespace to disambiguate", name, h.pkg, pkg)
+		}
+		if h.symbol != symbol && h.symbol != "" && symbol != "" {
+			return "", fmt.Errorf("handler %s is derived from both %s and %s, use WithName to give closures and method values distinct names", name, h.symbol, symbol)
+		}
+		return "", fmt.Errorf("handler %s already registered", name)
 	}
-	opts.handlerOptions = nil
 
 	info := &handlerInfo{
 		dispatchId: a.DispatchId,
 		name:       name,
+		pkg:        pkg,
+		symbol:     symbol,
 		options:    opts.handlerOptions,
 		handler:    handler,
 		timeout:    opts.timeout,
+		pool:       pool,
+		middleware: opts.middleware,
 	}
 	a.handlers = append(a.handlers, info)
-	return a.registerHandler(info)
+	id, err := a.registerHandler(context.Background(), info)
+	if err != nil {
+		a.handlersRegistered.Store(false)
+		return "", err
+	}
+	if id == "" {
+		// not registered until this replica is elected leader
+		id = uuid.New().String()
+	}
+	info.id = id
+	if a.endpointMode == EndpointRegisterAll {
+		a.registerWithStandbys(context.Background(), info)
+	}
+	return id, nil
 }
 
-func (a *Agent) registerHandler(info *handlerInfo) (string, error) {
+// registerHandler registers the handler with the active endpoint, handlersMu must be held
+func (a *Agent) registerHandler(ctx context.Context, info *handlerInfo) (string, error) {
+	options, ok := a.registrationOptions(info)
+	if !ok {
+		a.logger.Debug("not registering scheduled handler, this replica is not the leader", zap.String("handler", info.name))
+		return "", nil
+	}
+	return a.registerHandlerWith(ctx, a.activeClient(), info, options)
+}
+
+func (a *Agent) registerHandlerWith(ctx context.Context, client grpcClient, info *handlerInfo, options []*pb.HandlerOption) (string, error) {
 
-	stub := a.client.agent()
+	stub := client.agent()
 	if stub == nil {
 		return "", fmt.Errorf("failed to create agent connection")
 	}
 
-	res, err := stub.RegisterHandler(context.Background(), &pb.RegisterHandlerRequest{
+	res, err := stub.RegisterHandler(ctx, &pb.RegisterHandlerRequest{
 		DispatchId:  a.DispatchId,
 		HandlerName: info.name,
 		TimeoutMs:   int32(info.timeout.Milliseconds()),
-		Options:     info.options,
+		Options:     options,
 	})
 
 	if err != nil {
 		return "", err
 	}
 	a.registeredHandlers[res.Id] = info
+	a.registeredWith[res.Id] = client
 	return res.Id, nil
 }
 
-// UnregisterHandler unregisters a handler by id
+// UnregisterHandler unregisters the handler with the id returned by RegisterHandler,
+// removing all of its registrations with any endpoint
 func (a *Agent) UnregisterHandler(id string) error {
 
-	stub := a.client.agent()
+	a.handlersMu.Lock()
+	defer a.handlersMu.Unlock()
+
+	info := a.registeredHandlers[id]
+	for i, h := range a.handlers {
+		if h.id == id {
+			info = h
+		}
+		if h == info {
+			a.handlers = append(a.handlers[:i], a.handlers[i+1:]...)
+			break
+		}
+	}
+	if info == nil {
+		return a.unregisterHandlerId(context.Background(), id)
+	}
+
+	var err error
+	for otherId, h := range a.registeredHandlers {
+		if h == info {
+			err = errors.Join(err, a.unregisterHandlerId(context.Background(), otherId))
+		}
+	}
+	return err
+}
+
+// unregisterHandlerId unregisters a single registration from the endpoint it was
+// made with, handlersMu must be held
+func (a *Agent) unregisterHandlerId(ctx context.Context, id string) error {
+
+	client, ok := a.registeredWith[id]
+	if !ok {
+		client = a.activeClient()
+	}
+
+	err := a.unregisterWith(ctx, client, id)
+	// even if we error we want to drop this handler
+	delete(a.registeredHandlers, id)
+	delete(a.registeredWith, id)
+	return err
+}
+
+func (a *Agent) unregisterWith(ctx context.Context, client grpcClient, id string) error {
+
+	stub := client.agent()
 	if stub == nil {
 		return fmt.Errorf("failed to create agent connection")
 	}
 
-	_, err := stub.UnregisterHandler(context.Background(), &pb.UnregisterHandlerRequest{
+	_, err := stub.UnregisterHandler(ctx, &pb.UnregisterHandlerRequest{
 		Id: id,
 	})
 	if err != nil {
 		a.logger.Warn("failed to unregister handler", zap.Error(err))
 	}
-	// even if we error we want to drop this handler
-	delete(a.registeredHandlers, id)
 	return err
 }
 
-func (a Agent) reregisterHandlers() error {
+// reregisterHandlers registers every handler with the active endpoint again,
+// replacing any previous registrations with it
+func (a *Agent) reregisterHandlers(ctx context.Context) error {
 	a.logger.Warn("reregistering handlers")
+	err := a.reregisterMatchingHandlers(ctx, func(*handlerInfo) bool { return true })
+	a.handlersRegistered.Store(err == nil)
+	return err
+}
+
+// reregisterMatchingHandlers registers the handlers matching filter with the active
+// endpoint again, replacing any previous registrations with it.  Scheduled handlers
+// are also unregistered from every other endpoint, so only the active endpoint fires
+// their schedule.
+func (a *Agent) reregisterMatchingHandlers(ctx context.Context, filter func(*handlerInfo) bool) error {
+	a.handlersMu.Lock()
+	defer a.handlersMu.Unlock()
+
+	if err := a.unregisterStale(ctx); err != nil {
+		a.logger.Error("failed to unregister scheduled handler", zap.Error(err))
+		return err
+	}
+
+	client := a.activeClient()
 	for _, handler := range a.handlers {
+		if !filter(handler) {
+			continue
+		}
 
+		scheduled := isScheduledHandler(handler)
 		for id, h := range a.registeredHandlers {
-			if h.name == handler.name {
-				a.UnregisterHandler(id)
+			if h.name != handler.name {
+				continue
+			}
+			other := a.registeredWith[id]
+			if other != client && !scheduled {
+				continue
+			}
+			if err := a.unregisterHandlerId(ctx, id); err != nil && scheduled {
+				// try again when reregistering next, so the schedule doesn't fire
+				// twice.  Left on the active endpoint it would fire alongside the new
+				// registration or another leader's, so give up reregistering for now.
+				a.staleRegistrations[id] = other
+				if other == client {
+					return err
+				}
 			}
 		}
 
-		_, err := a.registerHandler(handler)
+		_, err := a.registerHandler(ctx, handler)
 		if err != nil {
 			a.logger.Error("failed to reregister handler", zap.Error(err))
 			return err
 		}
+		if a.endpointMode == EndpointRegisterAll {
+			a.registerWithStandbys(ctx, handler)
+		}
 	}
 	return nil
 }
 
-const sleepErrorWait = 5 * time.Second
-
 // Run starts the agent and begins dispatching invocations to the registered handlers.
+// Every handler runs with a context derived from ctx, so cancelling it cancels running
+// handlers as well as the dispatch stream.  It returns once ctx is cancelled, the agent
+// reports the work is completed, Stop is called or the backoff policy gives up
+// reconnecting, after waiting for running handlers to finish.
 func (a *Agent) Run(ctx context.Context) error {
+
+	// acceptCtx ends when we should no longer accept invocations
+	acceptCtx, cancelAccept := context.WithCancel(ctx)
+	defer cancelAccept()
+	stopAccept := context.AfterFunc(a.stopCtx, cancelAccept)
+	defer stopAccept()
+	if a.stopCtx.Err() != nil {
+		cancelAccept()
+	}
+
+	if len(a.shutdownSignals) > 0 {
+		stopSignals := a.stopOnSignal(acceptCtx)
+		defer stopSignals()
+	}
+
+	// a previous Run may have given up, this one starts reconnecting afresh
+	a.gaveUp.Store(false)
+
+	if a.health.Addr != "" {
+		if err := a.startHealthServer(); err != nil {
+			return err
+		}
+		defer func() {
+			if a.gaveUp.Load() {
+				a.keepHealthServer()
+				return
+			}
+			a.stopHealthServer()
+		}()
+	}
+
+	if a.leaderElection != nil {
+		a.electLeader(acceptCtx)
+		electionDone := make(chan struct{})
+		go func() {
+			defer close(electionDone)
+			a.runLeaderElection(acceptCtx)
+		}()
+		defer func() {
+			cancelAccept()
+			<-electionDone
+		}()
+	}
+
+	defer a.setConnectionState(ConnectionIdle)
+	a.setConnectionState(ConnectionConnecting)
+
+	var runErr error
 	exit := false
-	reregister := false
+	// retry registrations that failed before Run was called
+	reregister := !a.handlersRegistered.Load()
+	retry := newBackoff(a.backoff)
 	sleepOnError := func(err error) {
 
 		if a.sleepOnError == 0 {
@@ -240,34 +578,43 @@ func (a *Agent) Run(ctx context.Context) error {
 			return
 		}
 
+		a.metrics.ReconnectAttempted()
 		reregister = true
-		a.logger.Error("error in agent, sleeping for "+sleepErrorWait.String(), zap.Error(err))
-		time.Sleep(sleepErrorWait)
-	}
-
-	runningHandlers := sync.WaitGroup{}
+		if a.nextEndpoint() {
+			a.logger.Error("error in agent, failing over", zap.Error(err))
+			a.setConnectionState(ConnectionConnecting)
+			return
+		}
 
-	go func() {
-		select {
-		case <-ctx.Done():
-			exit = true
-		case <-a.done:
+		wait, ok := retry.next()
+		if !ok {
+			a.logger.Error("error in agent, giving up", zap.Error(err))
+			a.setConnectionState(ConnectionGaveUp)
+			retry.giveUp(err)
+			runErr = fmt.Errorf("giving up connecting to agent: %w", err)
 			exit = true
+			return
 		}
-	}()
 
-	for !exit {
+		a.setConnectionState(ConnectionDisconnected)
+		a.logger.Error("error in agent, retrying in "+wait.String(), zap.Error(err))
+		sleep(acceptCtx, wait)
+		a.setConnectionState(ConnectionConnecting)
+	}
+
+	for !exit && acceptCtx.Err() == nil {
 
 		// aquire an agent and register handlers if needed
 		// this allows agent crash/restart to recover
-		stub := a.client.agent()
+		client := a.activeClient()
+		stub := client.agent()
 		if stub == nil {
 			sleepOnError(fmt.Errorf("failed to create agent connection"))
 			continue
 		}
 
 		if reregister {
-			err := a.reregisterHandlers()
+			err := a.reregisterHandlers(acceptCtx)
 
 			if err != nil {
 				sleepOnError(err)
@@ -277,7 +624,7 @@ func (a *Agent) Run(ctx context.Context) error {
 
 		reregister = false
 
-		stream, err := stub.Dispatch(context.Background())
+		stream, err := stub.Dispatch(acceptCtx)
 		if err != nil {
 			sleepOnError(err)
 			continue
@@ -295,19 +642,30 @@ func (a *Agent) Run(ctx context.Context) error {
 			continue
 		}
 
-		err = a.processDispatchStream(ctx, stream, &runningHandlers)
+		a.messageReceived()
+		a.setConnectionState(ConnectionConnected)
+		a.failedEndpoints = 0
+		retry.reset()
+
+		err = a.processDispatchStream(ctx, acceptCtx, client, stream)
 
 		if err == errWorkCompleted {
 			close(a.done)
 			break
 		}
 
-		if err != nil {
+		if err != nil && acceptCtx.Err() == nil {
 			a.logger.Error("dispatch stream exited", zap.Error(err))
+			sleepOnError(err)
+			continue
 		}
+		a.setConnectionState(ConnectionConnecting)
 
 	}
-	runningHandlers.Wait()
+	a.runningHandlers.Wait()
+	if runErr != nil {
+		return runErr
+	}
 	return ctx.Err()
 }
 
@@ -328,13 +686,19 @@ func (a *Agent) setReportError(report *pb.ReportInvocationRequest, code string,
 }
 
 func (a *Agent) setReportResult(report *pb.ReportInvocationRequest, result any) {
-	if result == nil {
+	if isNilResult(result) {
+		return
+	}
+
+	encoded, err := a.encodeResult(result)
+	if err != nil {
+		a.setReportError(report, ErrorCodeEncoding, fmt.Errorf("failed to encode result: %w", err))
 		return
 	}
 
 	report.Message = &pb.ReportInvocationRequest_Result{
 		Result: &pb.InvokeResult{
-			Value: fmt.Sprintf("%v", result),
+			Value: encoded.Value,
 		},
 	}
 }
@@ -343,11 +707,17 @@ const dispatchSleep = 100 * time.Millisecond
 
 var errWorkCompleted = errors.New("work completed")
 
-func (a *Agent) processDispatchStream(ctx context.Context, stream grpc.BidiStreamingClient[pb.DispatchRequest, pb.DispatchMessage], runningHandlers *sync.WaitGroup) error {
+// processDispatchStream receives invocations from the stream, which was opened with
+// client, until it ends.  Handlers are run with ctx, while acceptCtx ends when no
+// further invocations should be started.
+func (a *Agent) processDispatchStream(ctx context.Context, acceptCtx context.Context, client grpcClient, stream grpc.BidiStreamingClient[pb.DispatchRequest, pb.DispatchMessage]) error {
 	defer stream.CloseSend()
 	for {
 
 		req, err := stream.Recv()
+		if acceptCtx.Err() != nil {
+			return nil
+		}
 		if err != nil {
 			status, _ := status.FromError(err)
 			if err == io.EOF || status.Code() == codes.Unavailable {
@@ -362,6 +732,7 @@ func (a *Agent) processDispatchStream(ctx context.Context, stream grpc.BidiStrea
 			time.Sleep(dispatchSleep)
 			continue
 		}
+		a.messageReceived()
 
 		switch req.Type {
 		case pb.DispatchMessageType_DISPATCH_MESSAGE_INVOKE:
@@ -371,18 +742,7 @@ func (a *Agent) processDispatchStream(ctx context.Context, stream grpc.BidiStrea
 				continue
 			}
 
-			timeoutCtx := ctx
-			cancel := func() {}
-			if invoke.TimeoutMs != 0 {
-				timeoutCtx, cancel = context.WithTimeout(context.Background(), time.Millisecond*time.Duration(invoke.TimeoutMs))
-			}
-
-			runningHandlers.Add(1)
-			go func() {
-				defer runningHandlers.Done()
-				defer cancel()
-				a.invokeHandler(timeoutCtx, invoke)
-			}()
+			a.dispatchInvoke(ctx, acceptCtx, client, invoke)
 		case pb.DispatchMessageType_DISPATCH_MESSAGE_WORK_COMPLETED:
 			a.logger.Info("work completed, shutting down")
 			return errWorkCompleted
@@ -392,51 +752,183 @@ func (a *Agent) processDispatchStream(ctx context.Context, stream grpc.BidiStrea
 	}
 }
 
-func (a *Agent) invokeHandler(ctx context.Context, invoke *pb.DispatchHandlerInvoke) {
+// dispatchInvoke claims a concurrency slot for the invocation and runs it once
+// the slot is granted.  This blocks when a full queue has the OverflowBlock policy.
+// The invocation is reported with client, the endpoint that dispatched it.
+func (a *Agent) dispatchInvoke(ctx context.Context, acceptCtx context.Context, client grpcClient, invoke *pb.DispatchHandlerInvoke) {
+	if invoke.InvocationId != "" && !a.recentInvocations.add(invoke.InvocationId) {
+		a.logger.Debug("skipping duplicate invocation",
+			zap.String("handler", invoke.HandlerName),
+			zap.String("invocation", invoke.InvocationId),
+		)
+		return
+	}
+
+	a.handlersMu.Lock()
 	handlerInfo, ok := a.registeredHandlers[invoke.HandlerId]
+	a.handlersMu.Unlock()
 	if !ok {
 		a.logger.Error("handler not found", zap.String("handler", invoke.HandlerName))
 		return
 	}
 
-	done := make(chan struct{})
+	slot, err := a.scheduler.acquire(acceptCtx, handlerInfo.pool)
+	if err != nil {
+		a.reportNotRun(client, invoke, a.notAcceptedError(err))
+		return
+	}
 
+	a.runningHandlers.Add(1)
+	go func() {
+		defer a.runningHandlers.Done()
+
+		if err := slot.wait(acceptCtx); err != nil {
+			a.reportNotRun(client, invoke, a.notAcceptedError(err))
+			return
+		}
+
+		invokeCtx, span := a.startInvocationSpan(ctx, invoke)
+		invokeCtx, abort := context.WithCancel(invokeCtx)
+		defer abort()
+
+		if invoke.TimeoutMs != 0 {
+			var cancel context.CancelFunc
+			invokeCtx, cancel = context.WithTimeout(invokeCtx, time.Millisecond*time.Duration(invoke.TimeoutMs))
+			defer cancel()
+		}
+
+		inv := a.trackInvocation(client, invoke, span, abort)
+		defer a.untrackInvocation(inv)
+		a.invokeHandler(invokeCtx, handlerInfo, inv, slot.release)
+	}()
+}
+
+// reportNotRun reports an invocation that was never started
+func (a *Agent) reportNotRun(client grpcClient, invoke *pb.DispatchHandlerInvoke, err error) {
+	a.logger.Warn("handler invocation not run",
+		zap.String("handler", invoke.HandlerName),
+		zap.Error(err),
+	)
 	report := &pb.ReportInvocationRequest{
 		HandlerInvoke:        invoke,
 		StartClientTimestamp: timestamppb.Now(),
 	}
+	a.setReportError(report, errorCode(err), err)
+	a.metrics.InvocationNotRun(invoke.HandlerName, invoke.Reason, errorCode(err))
 
-	go func() {
-		apiStub := a.client.api()
-
-		wrapped := zapcore.RegisterHooks(a.logger.Core(), func(entry zapcore.Entry) error {
-			report.Logs = append(report.Logs, &pb.Log{
-				Level:     entry.Level.CapitalString(),
-				Message:   entry.Message,
-				Timestamp: timestamppb.New(entry.Time),
-			})
-			return nil
-		})
+	ctx, span := a.startInvocationSpan(a.abortCtx, invoke)
+	endInvocationSpan(span, report)
+	a.reportInvocation(ctx, client, report)
+}
 
-		loggerFromCore := zap.New(wrapped)
+const maxReportAttempts = 5
 
-		handlerContext := NewHandlerContext(invoke, ctx, apiStub, loggerFromCore)
-		result, duration, err := a.executeHandlerWithRecover(handlerInfo, handlerContext)
-		report.DurationMs = int32(duration.Milliseconds())
+// reportInvocation reports the invocation to the agent with client, retrying
+// transient failures with the backoff policy until ctx ends.  ctx carries the
+// invocation's trace.
+func (a *Agent) reportInvocation(ctx context.Context, client grpcClient, report *pb.ReportInvocationRequest) {
+	stub := client.agent()
+	if stub == nil {
+		// no connection to the agent, or an invocation run by InvokeLocal
+		a.logger.Error("failed to report invocation, no agent connection")
+		return
+	}
 
-		if err != nil {
-			a.setReportError(report, "unexpected", err)
-		} else {
-			a.setReportResult(report, result)
+	retry := newBackoff(a.backoff)
+	for attempt := 1; ; attempt++ {
+		_, err := stub.ReportInvocation(ctx, report)
+		if err == nil {
+			return
+		}
+
+		if !isRetryable(err) || attempt >= maxReportAttempts {
+			a.logger.Error("failed to report invocation", zap.Error(err))
+			return
 		}
 
+		wait, ok := retry.next()
+		if !ok {
+			a.logger.Error("failed to report invocation, giving up", zap.Error(err))
+			return
+		}
+		a.logger.Warn("failed to report invocation, retrying in "+wait.String(), zap.Error(err))
+		if !sleep(ctx, wait) {
+			a.logger.Error("failed to report invocation, stopped retrying", zap.Error(err))
+			return
+		}
+	}
+}
+
+func isRetryable(err error) bool {
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.ResourceExhausted, codes.Aborted:
+		return true
+	}
+	return false
+}
+
+// invokeHandler runs the handler and reports the result, release is called
+// when the handler returns, which may be after a timeout has been reported
+func (a *Agent) invokeHandler(ctx context.Context, handlerInfo *handlerInfo, inv *invocation, release func()) {
+	if report := a.runInvocation(ctx, handlerInfo, inv, release); report != nil {
+		a.reportInvocation(trace.ContextWithSpan(a.abortCtx, inv.span), inv.client, report)
+	}
+}
+
+// runInvocation runs the handler until it returns or ctx ends, returning the report
+// for the invocation, or nil if it has already been reported by Stop
+func (a *Agent) runInvocation(ctx context.Context, handlerInfo *handlerInfo, inv *invocation, release func()) *pb.ReportInvocationRequest {
+
+	done := make(chan struct{})
+	invoke := inv.invoke
+
+	// set by the handler goroutine and only read once done is closed, as the
+	// goroutine may still be running when a timeout is reported
+	var (
+		result   any
+		duration time.Duration
+		err      error
+	)
+
+	go func() {
+		defer release()
+		var apiStub pb.CortexApiClient = &tracingApiClient{CortexApiClient: inv.client.api(), tracer: a.tracer}
+
+		// the handler name is only added to the console logs, the reported logs
+		// already belong to the handler
+		console := a.logger.With(handlerNameField(invoke))
+		core := zapcore.NewTee(console.Core(), inv.logs.core(a.logger.Core()))
+		handlerContext := newHandlerContext(invoke, ctx, apiStub, zap.New(core))
+		result, duration, err = a.executeHandlerWithRecover(handlerInfo, handlerContext)
 		close(done)
 	}()
 
+	report := &pb.ReportInvocationRequest{
+		HandlerInvoke:        invoke,
+		StartClientTimestamp: timestamppb.New(inv.start),
+	}
+
+	finished := false
 	select {
 	case <-done:
+		finished = true
+		report.DurationMs = int32(duration.Milliseconds())
+		if err != nil {
+			a.setReportError(report, errorCode(err), err)
+		} else {
+			a.setReportResult(report, result)
+		}
 	case <-ctx.Done():
-		a.setReportError(report, "timeout", nil)
+		if inv.isReported() {
+			// aborted by Stop, which has already reported it
+			return nil
+		}
+		report.DurationMs = int32(time.Since(inv.start).Milliseconds())
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			a.setReportError(report, ErrorCodeTimeout, nil)
+		} else {
+			a.setReportError(report, ErrorCodeCancelled, ctx.Err())
+		}
 	}
 
 	if report.GetError() == nil {
@@ -453,10 +945,12 @@ func (a *Agent) invokeHandler(ctx context.Context, invoke *pb.DispatchHandlerInv
 			zap.Any("error", report.GetError()),
 		)
 	}
-	_, err := a.client.agent().ReportInvocation(context.Background(), report)
-	if err != nil {
-		a.logger.Error("failed to report invocation", zap.Error(err))
+	if !inv.markReported() {
+		return nil
 	}
+	report.Logs = inv.logs.freeze()
+	a.finishInvocation(inv, report, finished && isPanic(err))
+	return report
 }
 
 func (a *Agent) executeHandlerWithRecover(handler *handlerInfo, ctx HandlerContext) (result any, d time.Duration, err error) {
@@ -467,20 +961,15 @@ func (a *Agent) executeHandlerWithRecover(handler *handlerInfo, ctx HandlerConte
 		d = time.Since(now)
 		if r := recover(); r != nil {
 			a.logger.Error("panic in handler", zap.Any("panic", r))
-			err = fmt.Errorf("panic in handler: %v", r)
+			err = &panicError{value: r}
 		}
 	}()
 
-	switch handler.handler.(type) {
-	case Handler:
-		h := handler.handler.(Handler)
-		err = h(ctx)
-	case InvocableHandler:
-		h := handler.handler.(InvocableHandler)
-		result, err = h(ctx)
-	default:
-		err = fmt.Errorf("unknown handler type: %T", handler.handler)
+	h, ok := asInvocableHandler(handler.handler)
+	if !ok {
+		return nil, d, fmt.Errorf("unknown handler type: %T", handler.handler)
 	}
 
+	result, err = chainMiddleware(h, a.middleware, handler.middleware)(ctx)
 	return result, d, err
 }
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -103,10 +104,10 @@ func TestInvokeHandlerWithTimeoutTriggered(t *testing.T) {
 	controller := gomock.NewController(t)
 	defer controller.Finish()
 
-	called := false
+	var called atomic.Bool
 
 	theHandler := func(ctx HandlerContext) error {
-		called = true
+		called.Store(true)
 		time.Sleep(time.Millisecond * 10)
 		return nil
 	}
@@ -117,7 +118,7 @@ func TestInvokeHandlerWithTimeoutTriggered(t *testing.T) {
 		require.Equal(t, "timeout", reportedErr.Code)
 	})
 
-	require.True(t, called)
+	require.True(t, called.Load())
 
 }
 
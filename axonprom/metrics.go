@@ -0,0 +1,143 @@
+// Package axonprom records Axon agent metrics with Prometheus
+package axonprom
+
+import (
+	"net/http"
+
+	"github.com/cortexapps/axon-go"
+	pb "github.com/cortexapps/axon-go/.generated/proto/github.com/cortexapps/axon"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Metrics is an axon.Metrics implementation recording Prometheus metrics, labelled
+// by handler name and invoke reason
+type Metrics struct {
+	registry *prometheus.Registry
+
+	invocations *prometheus.CounterVec
+	errors      *prometheus.CounterVec
+	timeouts    *prometheus.CounterVec
+	panics      *prometheus.CounterVec
+	duration    *prometheus.HistogramVec
+	inFlight    *prometheus.GaugeVec
+	reconnects  prometheus.Counter
+	state       *prometheus.GaugeVec
+}
+
+var _ axon.Metrics = (*Metrics)(nil)
+
+var connectionStates = []axon.ConnectionState{
+	axon.ConnectionIdle,
+	axon.ConnectionConnecting,
+	axon.ConnectionConnected,
+	axon.ConnectionDisconnected,
+	axon.ConnectionGaveUp,
+}
+
+// New creates the metrics and registers them with registry.  If registry is nil a
+// new registry is created, which Handler serves.
+func New(registry *prometheus.Registry) (*Metrics, error) {
+	if registry == nil {
+		registry = prometheus.NewRegistry()
+	}
+
+	labels := []string{"handler", "reason"}
+	m := &Metrics{
+		registry: registry,
+		invocations: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "axon_handler_invocations_total",
+			Help: "Handler invocations started.",
+		}, labels),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "axon_handler_errors_total",
+			Help: "Handler invocations reported with an error, including those that were not run, by error code.",
+		}, append(labels, "code")),
+		timeouts: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "axon_handler_timeouts_total",
+			Help: "Handler invocations that timed out.",
+		}, labels),
+		panics: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "axon_handler_panics_total",
+			Help: "Handler invocations that panicked.",
+		}, labels),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "axon_handler_duration_seconds",
+			Help:    "Duration of handler invocations.",
+			Buckets: prometheus.ExponentialBuckets(0.005, 4, 10),
+		}, labels),
+		inFlight: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "axon_handler_in_flight",
+			Help: "Handler invocations started and not yet reported, a timed out invocation is reported while its handler may still be running.",
+		}, labels),
+		reconnects: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "axon_reconnect_attempts_total",
+			Help: "Attempts to reconnect to the agent after an error.",
+		}),
+		state: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "axon_connection_state",
+			Help: "Connection state of the agent, 1 for the current state and 0 otherwise.",
+		}, []string{"state"}),
+	}
+
+	for _, c := range []prometheus.Collector{
+		m.invocations, m.errors, m.timeouts, m.panics, m.duration, m.inFlight, m.reconnects, m.state,
+	} {
+		if err := registry.Register(c); err != nil {
+			return nil, err
+		}
+	}
+
+	m.ConnectionStateChanged(axon.ConnectionIdle, axon.ConnectionIdle)
+	return m, nil
+}
+
+// Registry returns the registry the metrics are registered with
+func (m *Metrics) Registry() *prometheus.Registry {
+	return m.registry
+}
+
+// Handler returns an http.Handler serving the registry in the Prometheus format,
+// to be mounted at e.g. /metrics
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{Registry: m.registry})
+}
+
+func (m *Metrics) InvocationStarted(handler string, reason pb.HandlerInvokeType) {
+	m.invocations.WithLabelValues(handler, reason.String()).Inc()
+	m.inFlight.WithLabelValues(handler, reason.String()).Inc()
+}
+
+func (m *Metrics) InvocationFinished(outcome axon.InvocationOutcome) {
+	reason := outcome.Reason.String()
+	m.inFlight.WithLabelValues(outcome.Handler, reason).Dec()
+	m.duration.WithLabelValues(outcome.Handler, reason).Observe(outcome.Duration.Seconds())
+
+	if outcome.ErrorCode != "" {
+		m.errors.WithLabelValues(outcome.Handler, reason, outcome.ErrorCode).Inc()
+	}
+	if outcome.ErrorCode == axon.ErrorCodeTimeout {
+		m.timeouts.WithLabelValues(outcome.Handler, reason).Inc()
+	}
+	if outcome.Panicked {
+		m.panics.WithLabelValues(outcome.Handler, reason).Inc()
+	}
+}
+
+func (m *Metrics) InvocationNotRun(handler string, reason pb.HandlerInvokeType, code string) {
+	m.errors.WithLabelValues(handler, reason.String(), code).Inc()
+}
+
+func (m *Metrics) ReconnectAttempted() {
+	m.reconnects.Inc()
+}
+
+func (m *Metrics) ConnectionStateChanged(from axon.ConnectionState, to axon.ConnectionState) {
+	for _, state := range connectionStates {
+		value := 0.0
+		if state == to {
+			value = 1
+		}
+		m.state.WithLabelValues(state.String()).Set(value)
+	}
+}
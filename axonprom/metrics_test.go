@@ -0,0 +1,84 @@
+package axonprom
+
+import (
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cortexapps/axon-go"
+	pb "github.com/cortexapps/axon-go/.generated/proto/github.com/cortexapps/axon"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetrics(t *testing.T) {
+	m, err := New(nil)
+	require.NoError(t, err)
+
+	m.InvocationStarted("sync", pb.HandlerInvokeType_RUN_INTERVAL)
+	m.InvocationStarted("sync", pb.HandlerInvokeType_RUN_INTERVAL)
+	m.InvocationStarted("hook", pb.HandlerInvokeType_WEBHOOK)
+	require.Equal(t, 2.0, testutil.ToFloat64(m.inFlight.WithLabelValues("sync", "RUN_INTERVAL")))
+
+	m.InvocationFinished(axon.InvocationOutcome{Handler: "sync", Reason: pb.HandlerInvokeType_RUN_INTERVAL, Duration: time.Second})
+	m.InvocationFinished(axon.InvocationOutcome{Handler: "sync", Reason: pb.HandlerInvokeType_RUN_INTERVAL, ErrorCode: axon.ErrorCodeTimeout})
+	m.InvocationFinished(axon.InvocationOutcome{Handler: "hook", Reason: pb.HandlerInvokeType_WEBHOOK, ErrorCode: axon.ErrorCodeUnexpected, Panicked: true})
+	m.InvocationNotRun("sync", pb.HandlerInvokeType_RUN_INTERVAL, axon.ErrorCodeSkipped)
+
+	require.Equal(t, 2.0, testutil.ToFloat64(m.invocations.WithLabelValues("sync", "RUN_INTERVAL")))
+	require.Equal(t, 0.0, testutil.ToFloat64(m.inFlight.WithLabelValues("sync", "RUN_INTERVAL")))
+	require.Equal(t, 1.0, testutil.ToFloat64(m.timeouts.WithLabelValues("sync", "RUN_INTERVAL")))
+	require.Equal(t, 1.0, testutil.ToFloat64(m.errors.WithLabelValues("sync", "RUN_INTERVAL", axon.ErrorCodeTimeout)))
+	require.Equal(t, 1.0, testutil.ToFloat64(m.errors.WithLabelValues("sync", "RUN_INTERVAL", axon.ErrorCodeSkipped)))
+	require.Equal(t, 1.0, testutil.ToFloat64(m.panics.WithLabelValues("hook", "WEBHOOK")))
+	require.Equal(t, 0.0, testutil.ToFloat64(m.panics.WithLabelValues("sync", "RUN_INTERVAL")))
+	require.Equal(t, 2, testutil.CollectAndCount(m.duration))
+
+	m.ReconnectAttempted()
+	require.Equal(t, 1.0, testutil.ToFloat64(m.reconnects))
+
+	require.Equal(t, 1.0, testutil.ToFloat64(m.state.WithLabelValues("idle")))
+	m.ConnectionStateChanged(axon.ConnectionIdle, axon.ConnectionConnected)
+	require.Equal(t, 0.0, testutil.ToFloat64(m.state.WithLabelValues("idle")))
+	require.Equal(t, 1.0, testutil.ToFloat64(m.state.WithLabelValues("connected")))
+}
+
+func TestMetricsHandler(t *testing.T) {
+	m, err := New(nil)
+	require.NoError(t, err)
+	m.InvocationStarted("sync", pb.HandlerInvokeType_RUN_INTERVAL)
+
+	server := httptest.NewServer(m.Handler())
+	defer server.Close()
+
+	res, err := server.Client().Get(server.URL)
+	require.NoError(t, err)
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+
+	require.Contains(t, string(body), `axon_handler_invocations_total{handler="sync",reason="RUN_INTERVAL"} 1`)
+	require.Contains(t, string(body), `axon_connection_state{state="idle"} 1`)
+}
+
+func TestMetricsRegistry(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	m, err := New(registry)
+	require.NoError(t, err)
+	require.Same(t, registry, m.Registry())
+
+	// registering twice with the same registry fails
+	_, err = New(registry)
+	require.Error(t, err)
+
+	families, err := registry.Gather()
+	require.NoError(t, err)
+	var names []string
+	for _, family := range families {
+		names = append(names, family.GetName())
+	}
+	require.Contains(t, strings.Join(names, ","), "axon_reconnect_attempts_total")
+}
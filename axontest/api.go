@@ -0,0 +1,72 @@
+package axontest
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	pb "github.com/cortexapps/axon-go/.generated/proto/github.com/cortexapps/axon"
+	"google.golang.org/grpc"
+)
+
+// ApiHandler serves a Cortex API call made by a handler
+type ApiHandler func(ctx context.Context, req *pb.CallRequest) (*pb.CallResponse, error)
+
+// FakeApi is a pb.CortexApiClient serving calls with the handlers set up by the test
+// and recording the calls made.  Calls without a handler get a 404 response.
+type FakeApi struct {
+	mu       sync.Mutex
+	handlers map[string]ApiHandler
+	calls    []*pb.CallRequest
+}
+
+var _ pb.CortexApiClient = (*FakeApi)(nil)
+
+// NewFakeApi returns a FakeApi with no handlers
+func NewFakeApi() *FakeApi {
+	return &FakeApi{
+		handlers: make(map[string]ApiHandler),
+	}
+}
+
+// Handle serves calls with method and path, including any query string, using handler
+func (f *FakeApi) Handle(method, path string, handler ApiHandler) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.handlers[method+" "+path] = handler
+}
+
+// Respond serves calls with method and path, including any query string, with a
+// fixed JSON response
+func (f *FakeApi) Respond(method, path string, statusCode int, body string) {
+	f.Handle(method, path, func(ctx context.Context, req *pb.CallRequest) (*pb.CallResponse, error) {
+		return &pb.CallResponse{
+			StatusCode: int32(statusCode),
+			Body:       body,
+			Headers:    map[string]string{"Content-Type": "application/json"},
+		}, nil
+	})
+}
+
+// Calls returns the calls made so far
+func (f *FakeApi) Calls() []*pb.CallRequest {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]*pb.CallRequest(nil), f.calls...)
+}
+
+func (f *FakeApi) Call(ctx context.Context, req *pb.CallRequest, opts ...grpc.CallOption) (*pb.CallResponse, error) {
+	f.mu.Lock()
+	f.calls = append(f.calls, req)
+	handler := f.handlers[req.Method+" "+req.Path]
+	f.mu.Unlock()
+
+	if handler == nil {
+		return &pb.CallResponse{
+			StatusCode: 404,
+			Status:     "404 Not Found",
+			Body:       fmt.Sprintf(`{"message":"no axontest handler for %s %s"}`, req.Method, req.Path),
+		}, nil
+	}
+	return handler(ctx, req)
+}
@@ -0,0 +1,304 @@
+package axontest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"sync"
+
+	pb "github.com/cortexapps/axon-go/.generated/proto/github.com/cortexapps/axon"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"gopkg.in/yaml.v3"
+)
+
+// Cassette is a list of recorded Cortex API calls, stored as a YAML file
+type Cassette struct {
+	Interactions []Interaction `yaml:"interactions"`
+}
+
+// Interaction is a recorded Cortex API call and its outcome
+type Interaction struct {
+	Request  RecordedRequest  `yaml:"request"`
+	Response RecordedResponse `yaml:"response"`
+}
+
+// RecordedRequest is the request of a recorded call
+type RecordedRequest struct {
+	Method      string `yaml:"method"`
+	Path        string `yaml:"path"`
+	ContentType string `yaml:"content_type,omitempty"`
+	Body        string `yaml:"body,omitempty"`
+}
+
+// RecordedResponse is the response of a recorded call, or the error it failed with
+type RecordedResponse struct {
+	StatusCode int32             `yaml:"status_code,omitempty"`
+	Status     string            `yaml:"status,omitempty"`
+	Headers    map[string]string `yaml:"headers,omitempty"`
+	Body       string            `yaml:"body,omitempty"`
+	Error      *RecordedError    `yaml:"error,omitempty"`
+}
+
+// RecordedError is the gRPC error a recorded call failed with
+type RecordedError struct {
+	Code    codes.Code `yaml:"code"`
+	Message string     `yaml:"message"`
+}
+
+func recordRequest(req *pb.CallRequest) RecordedRequest {
+	return RecordedRequest{
+		Method:      req.Method,
+		Path:        req.Path,
+		ContentType: req.ContentType,
+		Body:        req.Body,
+	}
+}
+
+func recordResponse(res *pb.CallResponse, err error) RecordedResponse {
+	if err != nil {
+		s := status.Convert(err)
+		return RecordedResponse{Error: &RecordedError{Code: s.Code(), Message: s.Message()}}
+	}
+	return RecordedResponse{
+		StatusCode: res.StatusCode,
+		Status:     res.Status,
+		Headers:    res.Headers,
+		Body:       res.Body,
+	}
+}
+
+func (r RecordedResponse) replay() (*pb.CallResponse, error) {
+	if r.Error != nil {
+		return nil, status.Error(r.Error.Code, r.Error.Message)
+	}
+	return &pb.CallResponse{
+		StatusCode: r.StatusCode,
+		Status:     r.Status,
+		Headers:    r.Headers,
+		Body:       r.Body,
+	}, nil
+}
+
+// LoadCassette reads the cassette at path
+func LoadCassette(path string) (*Cassette, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var cassette Cassette
+	if err := yaml.Unmarshal(data, &cassette); err != nil {
+		return nil, fmt.Errorf("invalid cassette %s: %w", path, err)
+	}
+	return &cassette, nil
+}
+
+// Save writes the cassette to path
+func (c *Cassette) Save(path string) error {
+	data, err := yaml.Marshal(c)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// Recorder is a pb.CortexApiClient passing calls through to another client, such as
+// one connected to a real agent, and recording them into a Cassette
+type Recorder struct {
+	client pb.CortexApiClient
+
+	mu       sync.Mutex
+	cassette Cassette
+	calls    []*pb.CallRequest
+}
+
+var _ pb.CortexApiClient = (*Recorder)(nil)
+
+// NewRecorder returns a Recorder passing calls through to client
+func NewRecorder(client pb.CortexApiClient) *Recorder {
+	return &Recorder{client: client}
+}
+
+func (r *Recorder) Call(ctx context.Context, req *pb.CallRequest, opts ...grpc.CallOption) (*pb.CallResponse, error) {
+	res, err := r.client.Call(ctx, req, opts...)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.calls = append(r.calls, req)
+	r.cassette.Interactions = append(r.cassette.Interactions, Interaction{
+		Request:  recordRequest(req),
+		Response: recordResponse(res, err),
+	})
+	return res, err
+}
+
+// Cassette returns the calls recorded so far
+func (r *Recorder) Cassette() *Cassette {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return &Cassette{Interactions: append([]Interaction(nil), r.cassette.Interactions...)}
+}
+
+// Save writes the calls recorded so far to a cassette at path
+func (r *Recorder) Save(path string) error {
+	return r.Cassette().Save(path)
+}
+
+// requests returns the calls recorded so far
+func (r *Recorder) requests() []*pb.CallRequest {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]*pb.CallRequest(nil), r.calls...)
+}
+
+// Matcher reports whether a call matches a recorded request
+type Matcher func(recorded RecordedRequest, req *pb.CallRequest) bool
+
+// MatchMethod matches calls with the recorded HTTP method
+func MatchMethod(recorded RecordedRequest, req *pb.CallRequest) bool {
+	return recorded.Method == req.Method
+}
+
+// MatchPath matches calls with the recorded path, including any query string
+func MatchPath(recorded RecordedRequest, req *pb.CallRequest) bool {
+	return recorded.Path == req.Path
+}
+
+// MatchBody matches calls with the recorded body.  JSON bodies match if they decode
+// to the same value, regardless of formatting and the order of object keys.
+func MatchBody(recorded RecordedRequest, req *pb.CallRequest) bool {
+	if recorded.Body == req.Body {
+		return true
+	}
+
+	var want, got any
+	if json.Unmarshal([]byte(recorded.Body), &want) != nil || json.Unmarshal([]byte(req.Body), &got) != nil {
+		return false
+	}
+	return reflect.DeepEqual(want, got)
+}
+
+// DefaultMatchers returns the matchers a Replayer uses unless WithMatchers is given,
+// matching the method, path and body
+func DefaultMatchers() []Matcher {
+	return []Matcher{MatchMethod, MatchPath, MatchBody}
+}
+
+// ReplayOption configures a Replayer
+type ReplayOption func(*Replayer)
+
+// WithMatchers sets the matchers a call must satisfy to be served a recorded response
+func WithMatchers(matchers ...Matcher) ReplayOption {
+	return func(r *Replayer) {
+		r.matchers = matchers
+	}
+}
+
+// WithRepeat lets a recorded interaction be replayed any number of times, rather
+// than once
+func WithRepeat() ReplayOption {
+	return func(r *Replayer) {
+		r.repeat = true
+	}
+}
+
+// Replayer is a pb.CortexApiClient serving calls from a Cassette, so handler tests
+// run offline.  Each call is served the first matching interaction that has not
+// been replayed yet, in the order they were recorded.  Calls that match no
+// interaction fail with a NotFound error and are kept for Unmatched.
+type Replayer struct {
+	cassette *Cassette
+	matchers []Matcher
+	repeat   bool
+
+	mu        sync.Mutex
+	replayed  []bool
+	unmatched []*pb.CallRequest
+}
+
+var _ pb.CortexApiClient = (*Replayer)(nil)
+
+// NewReplayer returns a Replayer serving calls from cassette
+func NewReplayer(cassette *Cassette, options ...ReplayOption) *Replayer {
+	r := &Replayer{
+		cassette: cassette,
+		matchers: DefaultMatchers(),
+		replayed: make([]bool, len(cassette.Interactions)),
+	}
+	for _, opt := range options {
+		opt(r)
+	}
+	return r
+}
+
+// LoadReplayer returns a Replayer serving calls from the cassette at path
+func LoadReplayer(path string, options ...ReplayOption) (*Replayer, error) {
+	cassette, err := LoadCassette(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewReplayer(cassette, options...), nil
+}
+
+func (r *Replayer) Call(ctx context.Context, req *pb.CallRequest, opts ...grpc.CallOption) (*pb.CallResponse, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, interaction := range r.cassette.Interactions {
+		if r.replayed[i] && !r.repeat {
+			continue
+		}
+		if r.matches(interaction.Request, req) {
+			r.replayed[i] = true
+			return interaction.Response.replay()
+		}
+	}
+
+	r.unmatched = append(r.unmatched, req)
+	return nil, status.Errorf(codes.NotFound, "no recorded interaction matches %s %s %s", req.Method, req.Path, compactBody(req.Body))
+}
+
+func (r *Replayer) matches(recorded RecordedRequest, req *pb.CallRequest) bool {
+	for _, match := range r.matchers {
+		if !match(recorded, req) {
+			return false
+		}
+	}
+	return true
+}
+
+// Unmatched returns the calls that matched no recorded interaction
+func (r *Replayer) Unmatched() []*pb.CallRequest {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]*pb.CallRequest(nil), r.unmatched...)
+}
+
+// Unused returns the recorded interactions that have not been replayed, which a
+// test can check is empty to make sure the handler made every recorded call
+func (r *Replayer) Unused() []Interaction {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var unused []Interaction
+	for i, interaction := range r.cassette.Interactions {
+		if !r.replayed[i] {
+			unused = append(unused, interaction)
+		}
+	}
+	return unused
+}
+
+// compactBody returns a JSON body without insignificant whitespace, for error messages
+func compactBody(body string) string {
+	var buf bytes.Buffer
+	if json.Compact(&buf, []byte(body)) != nil {
+		return body
+	}
+	return buf.String()
+}
@@ -0,0 +1,134 @@
+package axontest
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/cortexapps/axon-go"
+	pb "github.com/cortexapps/axon-go/.generated/proto/github.com/cortexapps/axon"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type customDataArgs struct {
+	Tag   string `axon:"tag,required"`
+	Value string `axon:"value"`
+}
+
+func setCustomData(ctx axon.HandlerContext, args customDataArgs) (string, error) {
+	body := `{"key": "owner", "value": "` + args.Value + `"}`
+	res, err := ctx.CortexJsonApiCall("POST", "/api/v1/catalog/"+args.Tag+"/custom-data", body)
+	if err != nil {
+		return "", err
+	}
+	return res.Body, nil
+}
+
+func recordCassette(t *testing.T) string {
+	api := NewFakeApi()
+	api.Respond("POST", "/api/v1/catalog/my-service/custom-data", 200, `{"key":"owner","value":"team-a"}`)
+	api.Handle("GET", "/api/v1/catalog/down", func(ctx context.Context, req *pb.CallRequest) (*pb.CallResponse, error) {
+		return nil, status.Error(codes.Unavailable, "agent is down")
+	})
+
+	recorder := NewRecorder(api)
+	result, err := InvokeTyped(setCustomData, map[string]string{"tag": "my-service", "value": "team-a"}, WithApi(recorder))
+	require.NoError(t, err)
+	require.NoError(t, result.Err)
+
+	_, err = recorder.Call(context.Background(), &pb.CallRequest{Method: "GET", Path: "/api/v1/catalog/down"})
+	require.Error(t, err)
+
+	path := filepath.Join(t.TempDir(), "cassette.yaml")
+	require.NoError(t, recorder.Save(path))
+	return path
+}
+
+func TestCassetteRecordAndReplay(t *testing.T) {
+	path := recordCassette(t)
+
+	cassette, err := LoadCassette(path)
+	require.NoError(t, err)
+	require.Len(t, cassette.Interactions, 2)
+	require.Equal(t, RecordedRequest{
+		Method:      "POST",
+		Path:        "/api/v1/catalog/my-service/custom-data",
+		ContentType: "application/json",
+		Body:        `{"key": "owner", "value": "team-a"}`,
+	}, cassette.Interactions[0].Request)
+	require.Equal(t, &RecordedError{Code: codes.Unavailable, Message: "agent is down"}, cassette.Interactions[1].Response.Error)
+
+	replayer, err := LoadReplayer(path)
+	require.NoError(t, err)
+
+	result, err := InvokeTyped(setCustomData, map[string]string{"tag": "my-service", "value": "team-a"}, WithApi(replayer))
+	require.NoError(t, err)
+	require.NoError(t, result.Err)
+	require.Equal(t, `{"key":"owner","value":"team-a"}`, result.Value)
+
+	_, err = replayer.Call(context.Background(), &pb.CallRequest{Method: "GET", Path: "/api/v1/catalog/down"})
+	require.Equal(t, codes.Unavailable, status.Code(err))
+	require.Empty(t, replayer.Unused())
+	require.Empty(t, replayer.Unmatched())
+}
+
+func TestReplayerBodyMismatch(t *testing.T) {
+	replayer, err := LoadReplayer(recordCassette(t))
+	require.NoError(t, err)
+
+	// a payload regression no longer matches the recording
+	result, err := InvokeTyped(setCustomData, map[string]string{"tag": "my-service", "value": "team-b"}, WithApi(replayer))
+	require.NoError(t, err)
+	require.ErrorContains(t, result.Err, `no recorded interaction matches POST /api/v1/catalog/my-service/custom-data {"key":"owner","value":"team-b"}`)
+	require.Len(t, replayer.Unmatched(), 1)
+	require.Len(t, replayer.Unused(), 2)
+}
+
+func TestReplayerMatching(t *testing.T) {
+	cassette := &Cassette{Interactions: []Interaction{
+		{
+			Request:  RecordedRequest{Method: "PUT", Path: "/api/v1/catalog/custom-data", Body: `{"values":{"a":[{"key":"k","value":1}]}}`},
+			Response: RecordedResponse{StatusCode: 200, Body: "first"},
+		},
+		{
+			Request:  RecordedRequest{Method: "PUT", Path: "/api/v1/catalog/custom-data", Body: `{"values":{"b":[]}}`},
+			Response: RecordedResponse{StatusCode: 200, Body: "second"},
+		},
+	}}
+
+	call := func(r *Replayer, body string) (string, error) {
+		res, err := r.Call(context.Background(), &pb.CallRequest{Method: "PUT", Path: "/api/v1/catalog/custom-data", Body: body})
+		return res.GetBody(), err
+	}
+
+	// JSON bodies match regardless of formatting, and each interaction replays once
+	replayer := NewReplayer(cassette)
+	body, err := call(replayer, `{ "values": { "a": [ { "value": 1, "key": "k" } ] } }`)
+	require.NoError(t, err)
+	require.Equal(t, "first", body)
+	_, err = call(replayer, `{"values":{"a":[{"key":"k","value":1}]}}`)
+	require.Equal(t, codes.NotFound, status.Code(err))
+
+	// ignoring the body, interactions replay in the order they were recorded
+	replayer = NewReplayer(cassette, WithMatchers(MatchMethod, MatchPath))
+	for _, want := range []string{"first", "second"} {
+		body, err := call(replayer, `{}`)
+		require.NoError(t, err)
+		require.Equal(t, want, body)
+	}
+
+	replayer = NewReplayer(cassette, WithRepeat())
+	for i := 0; i < 3; i++ {
+		body, err := call(replayer, `{"values":{"b":[]}}`)
+		require.NoError(t, err)
+		require.Equal(t, "second", body)
+	}
+	require.Len(t, replayer.Unused(), 1)
+}
+
+func TestLoadCassetteMissing(t *testing.T) {
+	_, err := LoadCassette(filepath.Join(t.TempDir(), "missing.yaml"))
+	require.Error(t, err)
+}
@@ -0,0 +1,135 @@
+package axontest
+
+import (
+	"context"
+	"errors"
+
+	"github.com/cortexapps/axon-go"
+	pb "github.com/cortexapps/axon-go/.generated/proto/github.com/cortexapps/axon"
+)
+
+// Result is the outcome of a handler run by Invoke
+type Result struct {
+	// Value is the encoded result returned by an InvocableHandler, empty if it
+	// returned nil or failed
+	Value string
+	// Err is the error reported for the invocation, an *axon.HandlerError carrying
+	// the error code, or nil if the handler succeeded
+	Err error
+	// Logs are the handler's log entries reported with the invocation
+	Logs []*pb.Log
+	// ApiCalls are the Cortex API calls made by the handler
+	ApiCalls []*pb.CallRequest
+	// Report is the report the agent would have received for the invocation
+	Report *pb.ReportInvocationRequest
+}
+
+// InvokeOption configures a handler run by Invoke
+type InvokeOption func(*invokeOptions)
+
+type invokeOptions struct {
+	ctx            context.Context
+	api            pb.CortexApiClient
+	reason         pb.HandlerInvokeType
+	handlerOptions []axon.RegisterHandlerOption
+	agentOptions   []axon.Option
+}
+
+// WithContext runs the handler with ctx, cancelling ctx cancels the handler
+func WithContext(ctx context.Context) InvokeOption {
+	return func(o *invokeOptions) {
+		o.ctx = ctx
+	}
+}
+
+// WithApi serves the handler's Cortex API calls with api, such as a FakeApi or a
+// Replayer.  By default every call gets a 404 response.
+func WithApi(api pb.CortexApiClient) InvokeOption {
+	return func(o *invokeOptions) {
+		o.api = api
+	}
+}
+
+// WithReason sets the reason the handler is invoked for, the default is INVOKE
+func WithReason(reason pb.HandlerInvokeType) InvokeOption {
+	return func(o *invokeOptions) {
+		o.reason = reason
+	}
+}
+
+// WithHandlerOptions runs the handler with the options it is registered with, such
+// as axon.WithTimeout, axon.WithMiddleware or axon.WithName
+func WithHandlerOptions(options ...axon.RegisterHandlerOption) InvokeOption {
+	return func(o *invokeOptions) {
+		o.handlerOptions = append(o.handlerOptions, options...)
+	}
+}
+
+// WithAgentOptions runs the handler with an agent created with options, such as
+// axon.WithResultEncoder or axon.WithInvocationLogLimits
+func WithAgentOptions(options ...axon.Option) InvokeOption {
+	return func(o *invokeOptions) {
+		o.agentOptions = append(o.agentOptions, options...)
+	}
+}
+
+// Invoke runs handler, an axon.Handler or axon.InvocableHandler, once with args and
+// returns the outcome.  The handler runs the way the agent runs a dispatched
+// invocation, with its timeout, middleware, panic recovery and log capture, but
+// without any gRPC connection.  An error is returned if the handler cannot be run,
+// errors from the handler itself are in Result.Err.
+func Invoke(handler any, args map[string]string, options ...InvokeOption) (*Result, error) {
+	return invoke(args, options, func(ctx context.Context, agent *axon.Agent, invoke *pb.DispatchHandlerInvoke, o *invokeOptions) (*pb.ReportInvocationRequest, error) {
+		return agent.InvokeLocal(ctx, handler, invoke, o.api, o.handlerOptions...)
+	})
+}
+
+// InvokeTyped runs an axon.TypedHandler once with args, decoding them as
+// axon.RegisterTypedHandler does.  See Invoke.
+func InvokeTyped[In any, Out any](handler axon.TypedHandler[In, Out], args map[string]string, options ...InvokeOption) (*Result, error) {
+	return invoke(args, options, func(ctx context.Context, agent *axon.Agent, invoke *pb.DispatchHandlerInvoke, o *invokeOptions) (*pb.ReportInvocationRequest, error) {
+		return axon.InvokeTypedLocal(ctx, agent, handler, invoke, o.api, o.handlerOptions...)
+	})
+}
+
+type runFunc func(ctx context.Context, agent *axon.Agent, invoke *pb.DispatchHandlerInvoke, o *invokeOptions) (*pb.ReportInvocationRequest, error)
+
+func invoke(args map[string]string, options []InvokeOption, run runFunc) (*Result, error) {
+	o := &invokeOptions{
+		ctx:    context.Background(),
+		reason: pb.HandlerInvokeType_INVOKE,
+	}
+	for _, opt := range options {
+		opt(o)
+	}
+	if o.api == nil {
+		o.api = NewFakeApi()
+	}
+	// record the calls made by this invocation, api may be shared with others
+	recorder := NewRecorder(o.api)
+	o.api = recorder
+
+	agent := axon.NewAxonAgent(o.agentOptions...)
+	report, err := run(o.ctx, agent, &pb.DispatchHandlerInvoke{
+		Reason: o.reason,
+		Args:   args,
+	}, o)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &Result{
+		Value:    report.GetResult().GetValue(),
+		Logs:     report.Logs,
+		ApiCalls: recorder.requests(),
+		Report:   report,
+	}
+	if reported := report.GetError(); reported != nil {
+		var err error
+		if reported.Message != "" {
+			err = errors.New(reported.Message)
+		}
+		result.Err = axon.NewHandlerError(reported.Code, err)
+	}
+	return result, nil
+}
@@ -0,0 +1,120 @@
+package axontest
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/cortexapps/axon-go"
+	pb "github.com/cortexapps/axon-go/.generated/proto/github.com/cortexapps/axon"
+	"github.com/cortexapps/axon-go/cortex"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInvoke(t *testing.T) {
+	api := NewFakeApi()
+	api.Respond("GET", "/api/v1/catalog/my-service", 200, `{"tag":"my-service"}`)
+
+	result, err := InvokeTyped(catalogHandler, map[string]string{"tag": "my-service"},
+		WithApi(api),
+		WithHandlerOptions(axon.WithName("catalog")),
+	)
+	require.NoError(t, err)
+
+	require.NoError(t, result.Err)
+	require.Equal(t, `{"tag":"my-service"}`, result.Value)
+	require.Equal(t, `fetching entity {"tag":"my-service"}`, result.Logs[0].Message)
+	require.Len(t, result.ApiCalls, 1)
+	require.Equal(t, "/api/v1/catalog/my-service", result.ApiCalls[0].Path)
+	require.Equal(t, pb.HandlerInvokeType_INVOKE, result.Report.HandlerInvoke.Reason)
+
+	// calls are recorded per invocation
+	result, err = InvokeTyped(catalogHandler, map[string]string{"tag": "other"}, WithApi(api))
+	require.NoError(t, err)
+	require.Len(t, result.ApiCalls, 1)
+	require.Equal(t, "/api/v1/catalog/other", result.ApiCalls[0].Path)
+	require.Len(t, api.Calls(), 2)
+
+	var handlerErr *axon.HandlerError
+	require.ErrorAs(t, result.Err, &handlerErr)
+	require.Equal(t, axon.ErrorCodeUnexpected, handlerErr.Code)
+	require.ErrorContains(t, result.Err, "no axontest handler for GET /api/v1/catalog/other")
+}
+
+func TestInvokeInvalidArgs(t *testing.T) {
+	result, err := InvokeTyped(catalogHandler, nil)
+	require.NoError(t, err)
+
+	var handlerErr *axon.HandlerError
+	require.ErrorAs(t, result.Err, &handlerErr)
+	require.Equal(t, axon.ErrorCodeInvalidArgs, handlerErr.Code)
+	require.Empty(t, result.ApiCalls)
+}
+
+func TestInvokeTimeout(t *testing.T) {
+	handler := func(ctx axon.HandlerContext) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	result, err := Invoke(handler, nil, WithHandlerOptions(axon.WithTimeout(10*time.Millisecond)))
+	require.NoError(t, err)
+	require.Equal(t, axon.NewHandlerError(axon.ErrorCodeTimeout, nil), result.Err)
+}
+
+func TestInvokeCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	handler := func(ctx axon.HandlerContext) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	result, err := Invoke(handler, nil, WithContext(ctx))
+	require.NoError(t, err)
+	require.Equal(t, axon.NewHandlerError(axon.ErrorCodeCancelled, context.Canceled), result.Err)
+}
+
+func TestInvokePanic(t *testing.T) {
+	handler := func(ctx axon.HandlerContext) (any, error) {
+		panic(errors.New("boom"))
+	}
+
+	result, err := Invoke(handler, nil, WithReason(pb.HandlerInvokeType_RUN_INTERVAL))
+	require.NoError(t, err)
+	require.ErrorContains(t, result.Err, "boom")
+	require.Equal(t, pb.HandlerInvokeType_RUN_INTERVAL, result.Report.HandlerInvoke.Reason)
+}
+
+func TestInvokeUnknownHandler(t *testing.T) {
+	_, err := Invoke(func(string) {}, nil)
+	require.Error(t, err)
+}
+
+func TestInvokeCortexClient(t *testing.T) {
+	api := NewFakeApi()
+	api.Respond("GET", "/api/v1/catalog/my-service", 200, `{"tag":"my-service","name":"My Service","type":"service"}`)
+
+	handler := func(ctx axon.HandlerContext, args catalogArgs) (string, error) {
+		entity, err := axon.CortexClient(ctx).GetEntity(ctx, args.Tag)
+		if errors.Is(err, cortex.ErrNotFound) {
+			return "missing", nil
+		}
+		if err != nil {
+			return "", err
+		}
+		return entity.Name, nil
+	}
+
+	result, err := InvokeTyped(handler, map[string]string{"tag": "my-service"}, WithApi(api))
+	require.NoError(t, err)
+	require.NoError(t, result.Err)
+	require.Equal(t, "My Service", result.Value)
+
+	result, err = InvokeTyped(handler, map[string]string{"tag": "other"}, WithApi(api))
+	require.NoError(t, err)
+	require.NoError(t, result.Err)
+	require.Equal(t, "missing", result.Value)
+}
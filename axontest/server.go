@@ -0,0 +1,440 @@
+// Package axontest provides an in-memory axon agent for testing handlers end to end,
+// without running the agent or mocking the gRPC clients
+package axontest
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+
+	"github.com/cortexapps/axon-go"
+	pb "github.com/cortexapps/axon-go/.generated/proto/github.com/cortexapps/axon"
+	"github.com/google/uuid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+const bufferSize = 1024 * 1024
+
+// Server is an in-memory axon agent serving the AxonAgent and CortexApi services over
+// bufconn.  It records handler registrations, dispatch connections, invocation reports
+// and Cortex API calls, and lets tests invoke handlers, disconnect the dispatch stream
+// and complete the work.  Connect an agent to it with AgentOptions.
+type Server struct {
+	listener *bufconn.Listener
+	server   *grpc.Server
+
+	mu sync.Mutex
+	// changed is closed and replaced whenever the state below changes
+	changed       chan struct{}
+	registrations []*pb.RegisterHandlerRequest
+	handlers      map[string]*pb.HandlerInfo
+	sessions      []*dispatchSession
+	connections   int
+	reports       []*pb.ReportInvocationRequest
+
+	api *FakeApi
+}
+
+// dispatchSession is a connected dispatch stream
+type dispatchSession struct {
+	dispatchId string
+	messages   chan *pb.DispatchMessage
+	closed     chan struct{}
+	closeOnce  sync.Once
+}
+
+func (d *dispatchSession) close() {
+	d.closeOnce.Do(func() { close(d.closed) })
+}
+
+// NewServer starts a Server, which is stopped with Close
+func NewServer() *Server {
+	s := &Server{
+		listener: bufconn.Listen(bufferSize),
+		server:   grpc.NewServer(),
+		changed:  make(chan struct{}),
+		handlers: make(map[string]*pb.HandlerInfo),
+		api:      NewFakeApi(),
+	}
+	pb.RegisterAxonAgentServer(s.server, &agentService{server: s})
+	pb.RegisterCortexApiServer(s.server, &apiService{server: s})
+	go s.server.Serve(s.listener)
+	return s
+}
+
+// Close disconnects every client and stops the server
+func (s *Server) Close() {
+	s.Disconnect()
+	s.server.Stop()
+	s.listener.Close()
+}
+
+const target = "passthrough:///axontest"
+
+func (s *Server) dial(ctx context.Context, _ string) (net.Conn, error) {
+	return s.listener.DialContext(ctx)
+}
+
+// AgentOptions returns the options that connect an axon.Agent to the server
+func (s *Server) AgentOptions() []axon.Option {
+	return []axon.Option{
+		axon.WithTarget(target),
+		axon.WithDialOptions(grpc.WithContextDialer(s.dial)),
+	}
+}
+
+// ClientConn returns a connection to the server, for calling it directly, e.g. with
+// pb.NewAxonAgentClient to list handlers or fetch their history
+func (s *Server) ClientConn() (*grpc.ClientConn, error) {
+	return grpc.NewClient(target,
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithContextDialer(s.dial),
+	)
+}
+
+// update runs fn holding the lock and wakes up anything waiting for a change
+func (s *Server) update(fn func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fn()
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+// wait blocks until ready, which is called holding the lock, returns true or ctx ends
+func (s *Server) wait(ctx context.Context, ready func() bool) error {
+	for {
+		s.mu.Lock()
+		ok := ready()
+		changed := s.changed
+		s.mu.Unlock()
+		if ok {
+			return nil
+		}
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Registrations returns every RegisterHandler request received, including handlers
+// registered again after reconnecting
+func (s *Server) Registrations() []*pb.RegisterHandlerRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*pb.RegisterHandlerRequest(nil), s.registrations...)
+}
+
+// Handlers returns the handlers currently registered
+func (s *Server) Handlers() []*pb.HandlerInfo {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	handlers := make([]*pb.HandlerInfo, 0, len(s.handlers))
+	for _, handler := range s.handlers {
+		handlers = append(handlers, handler)
+	}
+	return handlers
+}
+
+// handlerNamed returns the registered handler with name, called holding the lock
+func (s *Server) handlerNamed(name string) *pb.HandlerInfo {
+	for _, handler := range s.handlers {
+		if handler.Name == name {
+			return handler
+		}
+	}
+	return nil
+}
+
+// WaitForHandler waits until a handler named name is registered and returns it
+func (s *Server) WaitForHandler(ctx context.Context, name string) (*pb.HandlerInfo, error) {
+	var handler *pb.HandlerInfo
+	err := s.wait(ctx, func() bool {
+		handler = s.handlerNamed(name)
+		return handler != nil
+	})
+	return handler, err
+}
+
+// Connections returns the number of dispatch streams opened so far, which grows
+// each time the agent reconnects
+func (s *Server) Connections() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.connections
+}
+
+// WaitForConnection waits until at least count dispatch streams have been opened and
+// one of them is still connected
+func (s *Server) WaitForConnection(ctx context.Context, count int) error {
+	return s.wait(ctx, func() bool {
+		return s.connections >= count && len(s.sessions) > 0
+	})
+}
+
+// Dispatch sends invoke to the dispatch stream of the agent that registered the
+// handler it names.  The invocation and handler ids are filled in if not set.
+// It returns the invocation id.
+func (s *Server) Dispatch(invoke *pb.DispatchHandlerInvoke) (string, error) {
+	s.mu.Lock()
+	handler := s.handlerNamed(invoke.HandlerName)
+	if handler == nil {
+		s.mu.Unlock()
+		return "", fmt.Errorf("handler %q is not registered", invoke.HandlerName)
+	}
+	var session *dispatchSession
+	for _, sess := range s.sessions {
+		if sess.dispatchId == handler.DispatchId {
+			session = sess
+		}
+	}
+	s.mu.Unlock()
+
+	if session == nil {
+		return "", fmt.Errorf("agent %s serving handler %q is not connected", handler.DispatchId, invoke.HandlerName)
+	}
+
+	if invoke.InvocationId == "" {
+		invoke.InvocationId = uuid.New().String()
+	}
+	if invoke.HandlerId == "" {
+		invoke.HandlerId = handler.Id
+	}
+	invoke.DispatchId = handler.DispatchId
+
+	msg := &pb.DispatchMessage{
+		Type:    pb.DispatchMessageType_DISPATCH_MESSAGE_INVOKE,
+		Message: &pb.DispatchMessage_Invoke{Invoke: invoke},
+	}
+	select {
+	case session.messages <- msg:
+		return invoke.InvocationId, nil
+	case <-session.closed:
+		return "", fmt.Errorf("agent %s disconnected", handler.DispatchId)
+	}
+}
+
+// Invoke dispatches an invocation of the handler named name with args, as the agent
+// does for the INVOKE reason, and waits for it to be reported
+func (s *Server) Invoke(ctx context.Context, name string, args map[string]string) (*pb.ReportInvocationRequest, error) {
+	id, err := s.Dispatch(&pb.DispatchHandlerInvoke{
+		HandlerName: name,
+		Reason:      pb.HandlerInvokeType_INVOKE,
+		Args:        args,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.WaitForReport(ctx, id)
+}
+
+// Reports returns the invocation reports received
+func (s *Server) Reports() []*pb.ReportInvocationRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*pb.ReportInvocationRequest(nil), s.reports...)
+}
+
+// WaitForReport waits for the invocation with invocationId to be reported
+func (s *Server) WaitForReport(ctx context.Context, invocationId string) (*pb.ReportInvocationRequest, error) {
+	var report *pb.ReportInvocationRequest
+	err := s.wait(ctx, func() bool {
+		for _, r := range s.reports {
+			if r.HandlerInvoke.GetInvocationId() == invocationId {
+				report = r
+				return true
+			}
+		}
+		return false
+	})
+	return report, err
+}
+
+// Disconnect ends every dispatch stream with an Unavailable error, as when the agent
+// restarts, so clients reconnect
+func (s *Server) Disconnect() {
+	s.mu.Lock()
+	sessions := s.sessions
+	s.mu.Unlock()
+
+	for _, session := range sessions {
+		session.close()
+	}
+}
+
+// WorkCompleted tells every connected client the work is completed, so Run returns
+func (s *Server) WorkCompleted() {
+	s.mu.Lock()
+	sessions := s.sessions
+	s.mu.Unlock()
+
+	msg := &pb.DispatchMessage{Type: pb.DispatchMessageType_DISPATCH_MESSAGE_WORK_COMPLETED}
+	for _, session := range sessions {
+		select {
+		case session.messages <- msg:
+		case <-session.closed:
+		}
+	}
+}
+
+// HandleApi serves Cortex API calls with method and path using handler.  Calls
+// without a handler get a 404 response.
+func (s *Server) HandleApi(method, path string, handler ApiHandler) {
+	s.api.Handle(method, path, handler)
+}
+
+// RespondApi serves Cortex API calls with method and path with a fixed response
+func (s *Server) RespondApi(method, path string, statusCode int, body string) {
+	s.api.Respond(method, path, statusCode, body)
+}
+
+// ApiCalls returns the Cortex API calls made so far
+func (s *Server) ApiCalls() []*pb.CallRequest {
+	return s.api.Calls()
+}
+
+type agentService struct {
+	pb.UnimplementedAxonAgentServer
+	server *Server
+}
+
+func (a *agentService) RegisterHandler(ctx context.Context, req *pb.RegisterHandlerRequest) (*pb.RegisterHandlerResponse, error) {
+	id := uuid.New().String()
+	a.server.update(func() {
+		s := a.server
+		s.registrations = append(s.registrations, req)
+
+		// registering again after reconnecting replaces the earlier registration
+		for existing, handler := range s.handlers {
+			if handler.DispatchId == req.DispatchId && handler.Name == req.HandlerName {
+				delete(s.handlers, existing)
+			}
+		}
+		s.handlers[id] = &pb.HandlerInfo{
+			Id:         id,
+			Name:       req.HandlerName,
+			DispatchId: req.DispatchId,
+			Options:    req.Options,
+			IsActive:   true,
+		}
+	})
+	return &pb.RegisterHandlerResponse{Id: id}, nil
+}
+
+func (a *agentService) UnregisterHandler(ctx context.Context, req *pb.UnregisterHandlerRequest) (*pb.UnregisterHandlerResponse, error) {
+	a.server.update(func() {
+		delete(a.server.handlers, req.Id)
+	})
+	return &pb.UnregisterHandlerResponse{}, nil
+}
+
+func (a *agentService) ListHandlers(ctx context.Context, req *pb.ListHandlersRequest) (*pb.ListHandlersResponse, error) {
+	return &pb.ListHandlersResponse{Handlers: a.server.Handlers()}, nil
+}
+
+func (a *agentService) GetHandlerHistory(ctx context.Context, req *pb.GetHandlerHistoryRequest) (*pb.GetHandlerHistoryResponse, error) {
+	var history []*pb.HandlerExecution
+	for _, report := range a.server.Reports() {
+		invoke := report.HandlerInvoke
+		if invoke.GetHandlerName() != req.HandlerName {
+			continue
+		}
+		execution := &pb.HandlerExecution{
+			HandlerName:          invoke.HandlerName,
+			HandlerId:            invoke.HandlerId,
+			InvocationId:         invoke.InvocationId,
+			DispatchId:           invoke.DispatchId,
+			StartClientTimestamp: report.StartClientTimestamp,
+			DurationMs:           report.DurationMs,
+			Error:                report.GetError(),
+		}
+		if req.IncludeLogs {
+			execution.Logs = report.Logs
+		}
+		history = append(history, execution)
+	}
+	if req.Tail > 0 && len(history) > int(req.Tail) {
+		history = history[len(history)-int(req.Tail):]
+	}
+	return &pb.GetHandlerHistoryResponse{History: history}, nil
+}
+
+func (a *agentService) Dispatch(stream grpc.BidiStreamingServer[pb.DispatchRequest, pb.DispatchMessage]) error {
+	req, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+
+	s := a.server
+	session := &dispatchSession{
+		dispatchId: req.DispatchId,
+		messages:   make(chan *pb.DispatchMessage),
+		closed:     make(chan struct{}),
+	}
+	s.update(func() {
+		s.sessions = append(s.sessions, session)
+		s.connections++
+	})
+	defer s.update(func() {
+		for i, sess := range s.sessions {
+			if sess == session {
+				s.sessions = append(s.sessions[:i], s.sessions[i+1:]...)
+				break
+			}
+		}
+	})
+	defer session.close()
+
+	received := make(chan error, 1)
+	go func() {
+		for {
+			if _, err := stream.Recv(); err != nil {
+				received <- err
+				return
+			}
+		}
+	}()
+
+	for {
+		select {
+		case msg := <-session.messages:
+			if err := stream.Send(msg); err != nil {
+				return err
+			}
+		case <-session.closed:
+			return status.Error(codes.Unavailable, "disconnected by axontest server")
+		case err := <-received:
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		case <-stream.Context().Done():
+			return stream.Context().Err()
+		}
+	}
+}
+
+func (a *agentService) ReportInvocation(ctx context.Context, req *pb.ReportInvocationRequest) (*pb.ReportInvocationResponse, error) {
+	a.server.update(func() {
+		a.server.reports = append(a.server.reports, req)
+	})
+	return &pb.ReportInvocationResponse{}, nil
+}
+
+type apiService struct {
+	pb.UnimplementedCortexApiServer
+	server *Server
+}
+
+func (a *apiService) Call(ctx context.Context, req *pb.CallRequest) (*pb.CallResponse, error) {
+	return a.server.api.Call(ctx, req)
+}
@@ -0,0 +1,174 @@
+package axontest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/cortexapps/axon-go"
+	pb "github.com/cortexapps/axon-go/.generated/proto/github.com/cortexapps/axon"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func startAgent(t *testing.T, server *Server, register func(agent *axon.Agent)) (*axon.Agent, <-chan error) {
+	options := append(server.AgentOptions(), axon.WithBackoff(axon.BackoffPolicy{
+		InitialInterval: 10 * time.Millisecond,
+		MaxInterval:     10 * time.Millisecond,
+	}))
+	agent := axon.NewAxonAgent(options...)
+	register(agent)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	runErr := make(chan error, 1)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		runErr <- agent.Run(ctx)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+
+	require.NoError(t, server.WaitForConnection(testContext(t), 1))
+	return agent, runErr
+}
+
+func testContext(t *testing.T) context.Context {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	t.Cleanup(cancel)
+	return ctx
+}
+
+type catalogArgs struct {
+	Tag string `axon:"tag,required"`
+}
+
+func catalogHandler(ctx axon.HandlerContext, args catalogArgs) (json.RawMessage, error) {
+	ctx.Logger().Info("fetching entity", zap.String("tag", args.Tag))
+	res, err := ctx.CortexJsonApiCall("GET", "/api/v1/catalog/"+args.Tag, "")
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != 200 {
+		return nil, errors.New(res.Body)
+	}
+	return json.RawMessage(res.Body), nil
+}
+
+func TestServerInvoke(t *testing.T) {
+	server := NewServer()
+	defer server.Close()
+	server.RespondApi("GET", "/api/v1/catalog/my-service", 200, `{"tag":"my-service"}`)
+
+	startAgent(t, server, func(agent *axon.Agent) {
+		_, err := axon.RegisterTypedHandler(agent, catalogHandler, axon.WithName("catalog"))
+		require.NoError(t, err)
+	})
+
+	handlers := server.Handlers()
+	require.Len(t, handlers, 1)
+	require.Equal(t, "catalog", handlers[0].Name)
+
+	report, err := server.Invoke(testContext(t), "catalog", map[string]string{"tag": "my-service"})
+	require.NoError(t, err)
+	require.Nil(t, report.GetError())
+	require.Equal(t, `{"tag":"my-service"}`, report.GetResult().GetValue())
+	require.Equal(t, `fetching entity {"tag":"my-service"}`, report.Logs[0].Message)
+
+	calls := server.ApiCalls()
+	require.Len(t, calls, 1)
+	require.Equal(t, "/api/v1/catalog/my-service", calls[0].Path)
+
+	// calls without a response configured get a 404
+	report, err = server.Invoke(testContext(t), "catalog", map[string]string{"tag": "other"})
+	require.NoError(t, err)
+	require.Equal(t, axon.ErrorCodeUnexpected, report.GetError().GetCode())
+	require.Contains(t, report.GetError().GetMessage(), "no axontest handler for GET /api/v1/catalog/other")
+	require.Len(t, server.Reports(), 2)
+}
+
+func TestServerDispatchUnknownHandler(t *testing.T) {
+	server := NewServer()
+	defer server.Close()
+
+	_, err := server.Dispatch(&pb.DispatchHandlerInvoke{HandlerName: "missing"})
+	require.ErrorContains(t, err, `handler "missing" is not registered`)
+}
+
+func TestServerDisconnect(t *testing.T) {
+	server := NewServer()
+	defer server.Close()
+
+	agent, _ := startAgent(t, server, func(agent *axon.Agent) {
+		_, err := agent.RegisterHandler(func(ctx axon.HandlerContext) error { return nil }, axon.WithName("handler"))
+		require.NoError(t, err)
+	})
+
+	server.Disconnect()
+
+	// the agent opens a new dispatch stream
+	require.NoError(t, server.WaitForConnection(testContext(t), 2))
+	require.Eventually(t, func() bool {
+		return agent.ConnectionState() == axon.ConnectionConnected
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Equal(t, 2, server.Connections())
+
+	report, err := server.Invoke(testContext(t), "handler", nil)
+	require.NoError(t, err)
+	require.Nil(t, report.GetError())
+}
+
+func TestServerWorkCompleted(t *testing.T) {
+	server := NewServer()
+	defer server.Close()
+
+	_, runErr := startAgent(t, server, func(agent *axon.Agent) {
+		_, err := agent.RegisterHandler(func(ctx axon.HandlerContext) error { return nil }, axon.WithName("handler"))
+		require.NoError(t, err)
+	})
+
+	server.WorkCompleted()
+	select {
+	case err := <-runErr:
+		require.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not return after the work completed")
+	}
+}
+
+func TestServerUnregisterAndHistory(t *testing.T) {
+	server := NewServer()
+	defer server.Close()
+
+	var id string
+	agent, _ := startAgent(t, server, func(agent *axon.Agent) {
+		var err error
+		id, err = agent.RegisterHandler(func(ctx axon.HandlerContext) error {
+			ctx.Logger().Info("running")
+			return nil
+		}, axon.WithName("handler"))
+		require.NoError(t, err)
+	})
+
+	_, err := server.Invoke(testContext(t), "handler", nil)
+	require.NoError(t, err)
+
+	conn, err := server.ClientConn()
+	require.NoError(t, err)
+	defer conn.Close()
+
+	history, err := pb.NewAxonAgentClient(conn).GetHandlerHistory(testContext(t), &pb.GetHandlerHistoryRequest{
+		HandlerName: "handler",
+		IncludeLogs: true,
+	})
+	require.NoError(t, err)
+	require.Len(t, history.History, 1)
+	require.Equal(t, "running", history.History[0].Logs[0].Message)
+
+	require.NoError(t, agent.UnregisterHandler(id))
+	require.Empty(t, server.Handlers())
+}
@@ -0,0 +1,120 @@
+package axon
+
+import (
+	"context"
+	"math/rand/v2"
+	"time"
+)
+
+// BackoffPolicy controls how long the agent waits before retrying after an error,
+// used when reconnecting the dispatch stream, reregistering handlers and
+// reporting invocations.  Zero InitialInterval, MaxInterval and Multiplier fields
+// are taken from DefaultBackoffPolicy.
+type BackoffPolicy struct {
+	// InitialInterval is the wait before the first retry
+	InitialInterval time.Duration
+	// MaxInterval caps the wait between retries
+	MaxInterval time.Duration
+	// Multiplier grows the wait after each retry, 1 keeps it constant
+	Multiplier float64
+	// RandomizationFactor adds jitter, e.g. 0.2 randomizes each wait by +/-20%
+	RandomizationFactor float64
+	// MaxElapsedTime is how long to keep retrying before giving up, zero retries forever
+	MaxElapsedTime time.Duration
+	// OnGiveUp is called with the last error when reconnecting to the agent gives up
+	OnGiveUp func(err error)
+}
+
+// DefaultBackoffPolicy returns the policy used when none is configured, an
+// exponential backoff from one second up to thirty seconds that never gives up
+func DefaultBackoffPolicy() BackoffPolicy {
+	return BackoffPolicy{
+		InitialInterval:     time.Second,
+		MaxInterval:         30 * time.Second,
+		Multiplier:          2,
+		RandomizationFactor: 0.2,
+	}
+}
+
+// ConstantBackoff returns a policy that always waits interval between retries
+func ConstantBackoff(interval time.Duration) BackoffPolicy {
+	return BackoffPolicy{
+		InitialInterval: interval,
+		MaxInterval:     interval,
+		Multiplier:      1,
+	}
+}
+
+// backoff tracks the retries of a single operation against a BackoffPolicy
+type backoff struct {
+	policy  BackoffPolicy
+	start   time.Time
+	current time.Duration
+}
+
+func newBackoff(policy BackoffPolicy) *backoff {
+	defaults := DefaultBackoffPolicy()
+	if policy.InitialInterval <= 0 {
+		policy.InitialInterval = defaults.InitialInterval
+	}
+	if policy.MaxInterval <= 0 {
+		policy.MaxInterval = defaults.MaxInterval
+	}
+	if policy.Multiplier <= 0 {
+		policy.Multiplier = defaults.Multiplier
+	}
+
+	b := &backoff{
+		policy: policy,
+	}
+	b.reset()
+	return b
+}
+
+// reset starts the backoff again, after the operation has succeeded
+func (b *backoff) reset() {
+	b.start = time.Now()
+	b.current = b.policy.InitialInterval
+}
+
+// next returns the wait before the next retry, or false if the policy
+// has run out of time
+func (b *backoff) next() (time.Duration, bool) {
+	if b.policy.MaxElapsedTime > 0 && time.Since(b.start) >= b.policy.MaxElapsedTime {
+		return 0, false
+	}
+
+	wait := b.current
+	if b.policy.RandomizationFactor > 0 {
+		delta := b.policy.RandomizationFactor * float64(wait)
+		wait = time.Duration(float64(wait) - delta + rand.Float64()*2*delta)
+	}
+
+	next := time.Duration(float64(b.current) * b.policy.Multiplier)
+	if b.policy.MaxInterval > 0 && next > b.policy.MaxInterval {
+		next = b.policy.MaxInterval
+	}
+	if next > b.current {
+		b.current = next
+	}
+	return wait, true
+}
+
+// giveUp calls the policy's OnGiveUp hook
+func (b *backoff) giveUp(err error) {
+	if b.policy.OnGiveUp != nil {
+		b.policy.OnGiveUp(err)
+	}
+}
+
+// sleep waits for d or until ctx is done, returning false if ctx ended first
+func sleep(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
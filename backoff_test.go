@@ -0,0 +1,169 @@
+package axon
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	pb "github.com/cortexapps/axon-go/.generated/proto/github.com/cortexapps/axon"
+	"github.com/cortexapps/axon-go/mock_axon"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestBackoffExponential(t *testing.T) {
+	b := newBackoff(BackoffPolicy{
+		InitialInterval: 10 * time.Millisecond,
+		MaxInterval:     40 * time.Millisecond,
+		Multiplier:      2,
+	})
+
+	expected := []time.Duration{10, 20, 40, 40}
+	for _, e := range expected {
+		wait, ok := b.next()
+		require.True(t, ok)
+		require.Equal(t, e*time.Millisecond, wait)
+	}
+
+	b.reset()
+	wait, _ := b.next()
+	require.Equal(t, 10*time.Millisecond, wait)
+}
+
+func TestBackoffJitter(t *testing.T) {
+	b := newBackoff(BackoffPolicy{
+		InitialInterval:     100 * time.Millisecond,
+		MaxInterval:         100 * time.Millisecond,
+		Multiplier:          1,
+		RandomizationFactor: 0.5,
+	})
+
+	for i := 0; i < 100; i++ {
+		wait, ok := b.next()
+		require.True(t, ok)
+		require.GreaterOrEqual(t, wait, 50*time.Millisecond)
+		require.LessOrEqual(t, wait, 150*time.Millisecond)
+	}
+}
+
+func TestBackoffMaxElapsedTime(t *testing.T) {
+	b := newBackoff(BackoffPolicy{
+		InitialInterval: time.Millisecond,
+		MaxElapsedTime:  10 * time.Millisecond,
+	})
+
+	_, ok := b.next()
+	require.True(t, ok)
+
+	time.Sleep(10 * time.Millisecond)
+	_, ok = b.next()
+	require.False(t, ok)
+}
+
+func TestBackoffDefaults(t *testing.T) {
+	b := newBackoff(BackoffPolicy{MaxElapsedTime: time.Minute})
+
+	wait, ok := b.next()
+	require.True(t, ok)
+	require.Equal(t, DefaultBackoffPolicy().InitialInterval, wait)
+	require.Equal(t, DefaultBackoffPolicy().InitialInterval*2, b.current)
+	require.Equal(t, time.Minute, b.policy.MaxElapsedTime)
+}
+
+func TestRunGivesUpReconnecting(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+
+	mu := sync.Mutex{}
+	states := []ConnectionState{}
+	var gaveUp error
+
+	agent := NewAxonAgent(
+		WithBackoff(BackoffPolicy{
+			InitialInterval: time.Millisecond,
+			Multiplier:      1,
+			MaxElapsedTime:  20 * time.Millisecond,
+			OnGiveUp: func(err error) {
+				gaveUp = err
+			},
+		}),
+		WithConnectionStateHook(func(from, to ConnectionState) {
+			mu.Lock()
+			defer mu.Unlock()
+			states = append(states, to)
+		}),
+	)
+	mock := &mockGrpcClient{
+		apiStub:   mock_axon.NewMockCortexApiClient(controller),
+		agentStub: mock_axon.NewMockAxonAgentClient(controller),
+	}
+	agent.client = mock
+
+	dispatchErr := status.Error(codes.Unavailable, "agent is down")
+	mock.agentStub.EXPECT().Dispatch(gomock.Any(), gomock.Any()).AnyTimes().Return(nil, dispatchErr)
+
+	err := agent.Run(context.Background())
+	require.ErrorIs(t, err, dispatchErr)
+	require.ErrorIs(t, gaveUp, dispatchErr)
+
+	require.Equal(t, ConnectionConnecting, states[0])
+	require.Equal(t, ConnectionDisconnected, states[1])
+	require.Equal(t, ConnectionGaveUp, states[len(states)-2])
+	require.Equal(t, ConnectionIdle, states[len(states)-1])
+	require.Equal(t, ConnectionIdle, agent.ConnectionState())
+}
+
+func TestReportInvocationRetries(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+	agent, mock := createAgent(controller)
+	agent.backoff = ConstantBackoff(time.Millisecond)
+
+	gomock.InOrder(
+		mock.agentStub.EXPECT().ReportInvocation(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil, status.Error(codes.Unavailable, "down")),
+		mock.agentStub.EXPECT().ReportInvocation(gomock.Any(), gomock.Any(), gomock.Any()).Return(&pb.ReportInvocationResponse{}, nil),
+	)
+	agent.reportInvocation(context.Background(), mock, &pb.ReportInvocationRequest{})
+
+	// non transient errors are not retried
+	mock.agentStub.EXPECT().ReportInvocation(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil, errors.New("bad request"))
+	agent.reportInvocation(context.Background(), mock, &pb.ReportInvocationRequest{})
+
+	// and retries are bounded
+	mock.agentStub.EXPECT().ReportInvocation(gomock.Any(), gomock.Any(), gomock.Any()).Times(maxReportAttempts).Return(nil, status.Error(codes.Unavailable, "down"))
+	agent.reportInvocation(context.Background(), mock, &pb.ReportInvocationRequest{})
+}
+
+func TestReportInvocationStopsRetryingWithContext(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+	agent, mock := createAgent(controller)
+
+	gaveUp := false
+	agent.backoff = ConstantBackoff(time.Hour)
+	agent.backoff.MaxElapsedTime = time.Nanosecond
+	agent.backoff.OnGiveUp = func(err error) {
+		gaveUp = true
+	}
+
+	// running out of time does not call the reconnect OnGiveUp hook
+	mock.agentStub.EXPECT().ReportInvocation(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil, status.Error(codes.Unavailable, "down"))
+	time.Sleep(time.Millisecond)
+	agent.reportInvocation(context.Background(), mock, &pb.ReportInvocationRequest{})
+	require.False(t, gaveUp)
+
+	// the wait between retries ends with the context
+	agent.backoff.MaxElapsedTime = 0
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	mock.agentStub.EXPECT().ReportInvocation(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil, status.Error(codes.Unavailable, "down"))
+
+	start := time.Now()
+	agent.reportInvocation(ctx, mock, &pb.ReportInvocationRequest{})
+	require.Less(t, time.Since(start), time.Second)
+	require.False(t, gaveUp)
+}
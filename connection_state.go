@@ -0,0 +1,75 @@
+package axon
+
+import (
+	"fmt"
+
+	"go.uber.org/zap"
+)
+
+// ConnectionState is the state of the agent's dispatch stream
+type ConnectionState int
+
+const (
+	// ConnectionIdle is the state before Run is called and after it returns
+	ConnectionIdle ConnectionState = iota
+	// ConnectionConnecting is the state while registering handlers and opening the dispatch stream
+	ConnectionConnecting
+	// ConnectionConnected is the state while the dispatch stream is open
+	ConnectionConnected
+	// ConnectionDisconnected is the state after the dispatch stream fails, while waiting to retry
+	ConnectionDisconnected
+	// ConnectionGaveUp is the state once the backoff policy has given up retrying
+	ConnectionGaveUp
+)
+
+func (s ConnectionState) String() string {
+	switch s {
+	case ConnectionIdle:
+		return "idle"
+	case ConnectionConnecting:
+		return "connecting"
+	case ConnectionConnected:
+		return "connected"
+	case ConnectionDisconnected:
+		return "disconnected"
+	case ConnectionGaveUp:
+		return "gave-up"
+	}
+	return fmt.Sprintf("ConnectionState(%d)", int(s))
+}
+
+// ConnectionStateHook is called when the agent's connection state changes
+type ConnectionStateHook func(from ConnectionState, to ConnectionState)
+
+// ConnectionState returns the current state of the agent's dispatch stream
+func (a *Agent) ConnectionState() ConnectionState {
+	a.stateMu.Lock()
+	defer a.stateMu.Unlock()
+	return a.state
+}
+
+func (a *Agent) setConnectionState(to ConnectionState) {
+	a.stateMu.Lock()
+	from := a.state
+	a.state = to
+	a.stateMu.Unlock()
+
+	if to == ConnectionGaveUp {
+		// the state is reset when Run returns, the health endpoints keep reporting
+		// that the agent gave up until Run is called again
+		a.gaveUp.Store(true)
+	}
+
+	if from == to {
+		return
+	}
+
+	a.logger.Debug("connection state changed",
+		zap.Stringer("from", from),
+		zap.Stringer("to", to),
+	)
+	a.metrics.ConnectionStateChanged(from, to)
+	for _, hook := range a.stateHooks {
+		hook(from, to)
+	}
+}
@@ -0,0 +1,97 @@
+package axon
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	pb "github.com/cortexapps/axon-go/.generated/proto/github.com/cortexapps/axon"
+	"github.com/cortexapps/axon-go/mock_axon"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+)
+
+type testContextKey string
+
+func TestRunContextPropagatesToHandlers(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+	agent, mock := createAgent(controller)
+
+	id := "cancellable"
+	stream := newBidiClient(&pb.DispatchMessage{
+		Type: pb.DispatchMessageType_DISPATCH_MESSAGE_INVOKE,
+		Message: &pb.DispatchMessage_Invoke{
+			Invoke: &pb.DispatchHandlerInvoke{
+				HandlerId:   id,
+				HandlerName: "cancellable",
+				TimeoutMs:   60000,
+			},
+		},
+	})
+
+	var streamCtx context.Context
+	reports := make(chan *pb.ReportInvocationRequest, 1)
+
+	mock.agentStub.EXPECT().RegisterHandler(gomock.Any(), gomock.Any()).Return(&pb.RegisterHandlerResponse{Id: id}, nil)
+	mock.agentStub.EXPECT().Dispatch(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[pb.DispatchRequest, pb.DispatchMessage], error) {
+			streamCtx = ctx
+			return stream, nil
+		})
+	mock.agentStub.EXPECT().ReportInvocation(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, req *pb.ReportInvocationRequest, opts ...grpc.CallOption) (*pb.ReportInvocationResponse, error) {
+			reports <- req
+			return &pb.ReportInvocationResponse{}, nil
+		})
+
+	key := testContextKey("key")
+	ctx, cancel := context.WithCancel(context.WithValue(context.Background(), key, "from-run"))
+
+	handlerValue := make(chan any, 1)
+	_, err := agent.RegisterHandler(func(hctx HandlerContext) error {
+		handlerValue <- hctx.Value(key)
+		cancel()
+		<-hctx.Done()
+		return hctx.Err()
+	}, WithTimeout(time.Minute))
+	require.NoError(t, err)
+
+	err = agent.Run(ctx)
+	require.ErrorIs(t, err, context.Canceled)
+
+	require.Equal(t, "from-run", <-handlerValue)
+	require.Equal(t, "from-run", streamCtx.Value(key))
+	require.ErrorIs(t, streamCtx.Err(), context.Canceled)
+
+	report := <-reports
+	require.Equal(t, ErrorCodeCancelled, report.GetError().GetCode())
+}
+
+// customHandlerContext is a HandlerContext implemented outside the package, which
+// has no Cortex method
+type customHandlerContext struct {
+	context.Context
+	api pb.CortexApiClient
+}
+
+func (c *customHandlerContext) Args() map[string]string { return nil }
+func (c *customHandlerContext) Api() pb.CortexApiClient { return c.api }
+func (c *customHandlerContext) Logger() *zap.Logger     { return zap.NewNop() }
+func (c *customHandlerContext) CortexJsonApiCall(method string, path string, jsonBody string) (*pb.CallResponse, error) {
+	return nil, nil
+}
+
+func TestCortexClient(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+	api := mock_axon.NewMockCortexApiClient(controller)
+
+	ctx := NewHandlerContext(&pb.DispatchHandlerInvoke{}, context.Background(), api, zap.NewNop())
+	require.Equal(t, api, CortexClient(ctx).Api())
+
+	custom := &customHandlerContext{Context: context.Background(), api: api}
+	require.Equal(t, api, CortexClient(custom).Api())
+}
@@ -0,0 +1,230 @@
+package cortex
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+	"strings"
+
+	pb "github.com/cortexapps/axon-go/.generated/proto/github.com/cortexapps/axon"
+)
+
+const catalogPath = "/api/v1/catalog"
+
+// Entity is a Cortex catalog entity, such as a service, resource or domain
+type Entity struct {
+	ID          string       `json:"id,omitempty"`
+	Tag         string       `json:"tag"`
+	Name        string       `json:"name"`
+	Description string       `json:"description,omitempty"`
+	Type        string       `json:"type"`
+	Groups      []string     `json:"groups,omitempty"`
+	Links       []Link       `json:"links,omitempty"`
+	Metadata    []CustomData `json:"metadata,omitempty"`
+	Owners      *Owners      `json:"owners,omitempty"`
+	Git         *Git         `json:"git,omitempty"`
+	IsArchived  bool         `json:"isArchived"`
+	LastUpdated string       `json:"lastUpdated,omitempty"`
+}
+
+// Link is a link listed on an entity
+type Link struct {
+	Name        string `json:"name"`
+	Type        string `json:"type"`
+	URL         string `json:"url"`
+	Description string `json:"description,omitempty"`
+}
+
+// Owners are the teams and individuals owning an entity
+type Owners struct {
+	Teams       []TeamOwner       `json:"teams,omitempty"`
+	Individuals []IndividualOwner `json:"individuals,omitempty"`
+}
+
+// TeamOwner is a team owning an entity
+type TeamOwner struct {
+	Tag         string `json:"tag"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Provider    string `json:"provider,omitempty"`
+	IsArchived  bool   `json:"isArchived"`
+}
+
+// IndividualOwner is a person owning an entity
+type IndividualOwner struct {
+	Email       string `json:"email"`
+	Description string `json:"description,omitempty"`
+}
+
+// Git is the repository an entity is linked to
+type Git struct {
+	Provider      string `json:"provider"`
+	Repository    string `json:"repository"`
+	RepositoryURL string `json:"repositoryUrl,omitempty"`
+	Alias         string `json:"alias,omitempty"`
+	Basepath      string `json:"basepath,omitempty"`
+}
+
+// ListOptions filters and pages the entities returned by ListEntities, the zero
+// value returns the first page of all unarchived entities
+type ListOptions struct {
+	// Page is the zero based page to return
+	Page int
+	// PageSize is the number of entities per page, the Cortex default if zero
+	PageSize int
+	// Types only returns entities of these types, such as "service"
+	Types []string
+	// Groups only returns entities in these groups
+	Groups []string
+	// Owners only returns entities owned by these teams or individuals
+	Owners []string
+	// GitRepositories only returns entities linked to these repositories
+	GitRepositories []string
+	// IncludeArchived also returns archived entities
+	IncludeArchived bool
+	// IncludeMetadata returns the entities' custom data in Entity.Metadata
+	IncludeMetadata bool
+	// IncludeLinks returns the entities' links in Entity.Links
+	IncludeLinks bool
+	// IncludeOwners returns the entities' owners in Entity.Owners
+	IncludeOwners bool
+}
+
+func (o ListOptions) query() url.Values {
+	query := url.Values{}
+	if o.Page > 0 {
+		query.Set("page", strconv.Itoa(o.Page))
+	}
+	if o.PageSize > 0 {
+		query.Set("pageSize", strconv.Itoa(o.PageSize))
+	}
+	setList := func(key string, values []string) {
+		if len(values) > 0 {
+			query.Set(key, strings.Join(values, ","))
+		}
+	}
+	setList("types", o.Types)
+	setList("groups", o.Groups)
+	setList("owners", o.Owners)
+	setList("gitRepositories", o.GitRepositories)
+	setBool := func(key string, value bool) {
+		if value {
+			query.Set(key, "true")
+		}
+	}
+	setBool("includeArchived", o.IncludeArchived)
+	setBool("includeMetadata", o.IncludeMetadata)
+	setBool("includeLinks", o.IncludeLinks)
+	setBool("includeOwners", o.IncludeOwners)
+	return query
+}
+
+// EntityPage is a page of entities returned by ListEntities
+type EntityPage struct {
+	Entities   []Entity `json:"entities"`
+	Page       int      `json:"page"`
+	TotalPages int      `json:"totalPages"`
+	Total      int      `json:"total"`
+}
+
+// ListEntities returns a page of the catalog's entities
+func (c *Client) ListEntities(ctx context.Context, options ListOptions) (*EntityPage, error) {
+	var page EntityPage
+	if err := c.call(ctx, "GET", withQuery(catalogPath, options.query()), nil, &page); err != nil {
+		return nil, err
+	}
+	return &page, nil
+}
+
+// AllEntities returns the catalog's entities from every page, starting at
+// options.Page
+func (c *Client) AllEntities(ctx context.Context, options ListOptions) ([]Entity, error) {
+	var entities []Entity
+	for {
+		page, err := c.ListEntities(ctx, options)
+		if err != nil {
+			return nil, err
+		}
+		entities = append(entities, page.Entities...)
+		if len(page.Entities) == 0 || page.Page+1 >= page.TotalPages {
+			return entities, nil
+		}
+		options.Page = page.Page + 1
+	}
+}
+
+// GetEntity returns the entity with tag, or an error matching ErrNotFound if there
+// is none
+func (c *Client) GetEntity(ctx context.Context, tag string) (*Entity, error) {
+	var entity Entity
+	if err := c.call(ctx, "GET", entityPath(tag), nil, &entity); err != nil {
+		return nil, err
+	}
+	return &entity, nil
+}
+
+// DescriptorOptions configures UpsertDescriptor
+type DescriptorOptions struct {
+	// DryRun validates the descriptor without changing the catalog
+	DryRun bool
+	// AppendArrays appends lists in the descriptor, such as links, to the entity's
+	// existing lists rather than replacing them
+	AppendArrays bool
+	// FailIfEntityExists fails with an error matching ErrConflict if the entity
+	// already exists, rather than updating it
+	FailIfEntityExists bool
+}
+
+// DescriptorResult is the outcome of UpsertDescriptor
+type DescriptorResult struct {
+	Ok         bool        `json:"ok"`
+	Violations []Violation `json:"violations,omitempty"`
+}
+
+// Violation is a problem found validating a descriptor
+type Violation struct {
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	Pointer     string `json:"pointer,omitempty"`
+}
+
+// UpsertDescriptor creates or updates the entity described by descriptor, an
+// entity descriptor in the cortex.yaml format as YAML or JSON
+func (c *Client) UpsertDescriptor(ctx context.Context, descriptor string, options DescriptorOptions) (*DescriptorResult, error) {
+	query := url.Values{}
+	if options.DryRun {
+		query.Set("dryRun", "true")
+	}
+	if options.AppendArrays {
+		query.Set("appendArrays", "true")
+	}
+	if options.FailIfEntityExists {
+		query.Set("failIfEntityExists", "true")
+	}
+
+	var result DescriptorResult
+	err := c.do(ctx, &pb.CallRequest{
+		Method:      "POST",
+		Path:        withQuery("/api/v1/open-api", query),
+		ContentType: "application/openapi;charset=UTF-8",
+		Body:        descriptor,
+	}, &result)
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// ArchiveEntity archives the entity with tag
+func (c *Client) ArchiveEntity(ctx context.Context, tag string) error {
+	return c.call(ctx, "PUT", entityPath(tag)+"/archive", nil, nil)
+}
+
+// UnarchiveEntity restores the archived entity with tag
+func (c *Client) UnarchiveEntity(ctx context.Context, tag string) error {
+	return c.call(ctx, "PUT", entityPath(tag)+"/unarchive", nil, nil)
+}
+
+func entityPath(tag string) string {
+	return catalogPath + "/" + url.PathEscape(tag)
+}
@@ -0,0 +1,152 @@
+package cortex
+
+import (
+	"context"
+	"testing"
+
+	pb "github.com/cortexapps/axon-go/.generated/proto/github.com/cortexapps/axon"
+	"github.com/cortexapps/axon-go/mock_axon"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+func createClient(t *testing.T) (*Client, *mock_axon.MockCortexApiClient) {
+	controller := gomock.NewController(t)
+	api := mock_axon.NewMockCortexApiClient(controller)
+	return NewClient(api), api
+}
+
+func expectCall(api *mock_axon.MockCortexApiClient, method string, path string, body string, statusCode int32, response string) {
+	api.EXPECT().Call(gomock.Any(), &callMatcher{method: method, path: path, body: body}).Return(&pb.CallResponse{
+		StatusCode: statusCode,
+		Body:       response,
+	}, nil)
+}
+
+type callMatcher struct {
+	method string
+	path   string
+	body   string
+}
+
+func (m *callMatcher) Matches(x any) bool {
+	req, ok := x.(*pb.CallRequest)
+	return ok && req.Method == m.method && req.Path == m.path && req.Body == m.body
+}
+
+func (m *callMatcher) String() string {
+	return m.method + " " + m.path + " " + m.body
+}
+
+func TestListEntities(t *testing.T) {
+	client, api := createClient(t)
+	expectCall(api, "GET", "/api/v1/catalog?groups=payments&includeOwners=true&page=2&pageSize=50&types=service%2Cresource", "", 200, `{
+		"entities": [{
+			"tag": "my-service",
+			"name": "My Service",
+			"type": "service",
+			"groups": ["payments"],
+			"owners": {"teams": [{"tag": "team-a", "name": "Team A", "isArchived": false}]},
+			"isArchived": false
+		}],
+		"page": 2,
+		"totalPages": 3,
+		"total": 101
+	}`)
+
+	page, err := client.ListEntities(context.Background(), ListOptions{
+		Page:          2,
+		PageSize:      50,
+		Types:         []string{"service", "resource"},
+		Groups:        []string{"payments"},
+		IncludeOwners: true,
+	})
+	require.NoError(t, err)
+	require.Equal(t, 2, page.Page)
+	require.Equal(t, 101, page.Total)
+	require.Equal(t, []Entity{{
+		Tag:    "my-service",
+		Name:   "My Service",
+		Type:   "service",
+		Groups: []string{"payments"},
+		Owners: &Owners{Teams: []TeamOwner{{Tag: "team-a", Name: "Team A"}}},
+	}}, page.Entities)
+}
+
+func TestAllEntities(t *testing.T) {
+	client, api := createClient(t)
+	gomock.InOrder(
+		api.EXPECT().Call(gomock.Any(), &callMatcher{method: "GET", path: "/api/v1/catalog?types=service"}).Return(&pb.CallResponse{
+			StatusCode: 200,
+			Body:       `{"entities": [{"tag": "a"}, {"tag": "b"}], "page": 0, "totalPages": 2, "total": 3}`,
+		}, nil),
+		api.EXPECT().Call(gomock.Any(), &callMatcher{method: "GET", path: "/api/v1/catalog?page=1&types=service"}).Return(&pb.CallResponse{
+			StatusCode: 200,
+			Body:       `{"entities": [{"tag": "c"}], "page": 1, "totalPages": 2, "total": 3}`,
+		}, nil),
+	)
+
+	entities, err := client.AllEntities(context.Background(), ListOptions{Types: []string{"service"}})
+	require.NoError(t, err)
+	require.Equal(t, []Entity{{Tag: "a"}, {Tag: "b"}, {Tag: "c"}}, entities)
+}
+
+func TestGetEntity(t *testing.T) {
+	client, api := createClient(t)
+	expectCall(api, "GET", "/api/v1/catalog/my%20service", "", 200, `{
+		"tag": "my service",
+		"name": "My Service",
+		"type": "service",
+		"metadata": [{"key": "tier", "value": 1}],
+		"links": [{"name": "runbook", "type": "runbook", "url": "https://example.com"}],
+		"git": {"provider": "github", "repository": "org/repo"}
+	}`)
+	expectCall(api, "GET", "/api/v1/catalog/missing", "", 404, `{"type": "NOT_FOUND", "message": "Entity missing not found"}`)
+
+	entity, err := client.GetEntity(context.Background(), "my service")
+	require.NoError(t, err)
+	require.Equal(t, &Entity{
+		Tag:      "my service",
+		Name:     "My Service",
+		Type:     "service",
+		Metadata: []CustomData{{Key: "tier", Value: float64(1)}},
+		Links:    []Link{{Name: "runbook", Type: "runbook", URL: "https://example.com"}},
+		Git:      &Git{Provider: "github", Repository: "org/repo"},
+	}, entity)
+
+	_, err = client.GetEntity(context.Background(), "missing")
+	require.ErrorIs(t, err, ErrNotFound)
+	require.EqualError(t, err, "cortex api GET /api/v1/catalog/missing: 404 Not Found: Entity missing not found")
+}
+
+func TestUpsertDescriptor(t *testing.T) {
+	client, api := createClient(t)
+	descriptor := "openapi: 3.0.1\ninfo:\n  title: My Service\n  x-cortex-tag: my-service\n"
+	api.EXPECT().Call(gomock.Any(), &pb.CallRequest{
+		Method:      "POST",
+		Path:        "/api/v1/open-api?appendArrays=true&dryRun=true",
+		ContentType: "application/openapi;charset=UTF-8",
+		Body:        descriptor,
+	}).Return(&pb.CallResponse{
+		StatusCode: 200,
+		Body:       `{"ok": false, "violations": [{"title": "Invalid owner", "description": "team-z does not exist", "pointer": "/info/x-cortex-owners/0"}]}`,
+	}, nil)
+
+	result, err := client.UpsertDescriptor(context.Background(), descriptor, DescriptorOptions{DryRun: true, AppendArrays: true})
+	require.NoError(t, err)
+	require.Equal(t, &DescriptorResult{
+		Violations: []Violation{{Title: "Invalid owner", Description: "team-z does not exist", Pointer: "/info/x-cortex-owners/0"}},
+	}, result)
+}
+
+func TestArchiveEntity(t *testing.T) {
+	client, api := createClient(t)
+	expectCall(api, "PUT", "/api/v1/catalog/my-service/archive", "", 200, `{"tag": "my-service", "isArchived": true}`)
+	expectCall(api, "PUT", "/api/v1/catalog/my-service/unarchive", "", 403, `{"details": "missing permission"}`)
+
+	require.NoError(t, client.ArchiveEntity(context.Background(), "my-service"))
+
+	err := client.UnarchiveEntity(context.Background(), "my-service")
+	require.ErrorIs(t, err, ErrForbidden)
+	require.EqualError(t, err, "cortex api PUT /api/v1/catalog/my-service/unarchive: 403 Forbidden: missing permission")
+}
@@ -0,0 +1,79 @@
+// Package cortex is a typed client for the Cortex REST API, making its calls through
+// the Axon agent's pb.CortexApiClient
+package cortex
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+
+	pb "github.com/cortexapps/axon-go/.generated/proto/github.com/cortexapps/axon"
+)
+
+const jsonContentType = "application/json"
+
+// Client calls the Cortex API through an agent's pb.CortexApiClient, which adds the
+// agent's credentials to each call.  Inside a handler use axon.CortexClient,
+// which traces the calls the way HandlerContext.Api does.
+type Client struct {
+	api pb.CortexApiClient
+}
+
+// NewClient returns a Client making its calls with api
+func NewClient(api pb.CortexApiClient) *Client {
+	return &Client{api: api}
+}
+
+// Api returns the pb.CortexApiClient the client makes its calls with, for endpoints
+// the client has no method for
+func (c *Client) Api() pb.CortexApiClient {
+	return c.api
+}
+
+// call makes a call with body encoded as JSON unless it is a string, and decodes a
+// 2xx response into out if it is not nil.  Other responses return an *APIError.
+func (c *Client) call(ctx context.Context, method string, path string, body any, out any) error {
+	req := &pb.CallRequest{
+		Method:      method,
+		Path:        path,
+		ContentType: jsonContentType,
+	}
+	switch b := body.(type) {
+	case nil:
+	case string:
+		req.Body = b
+	default:
+		data, err := json.Marshal(b)
+		if err != nil {
+			return fmt.Errorf("cannot encode %s %s request: %w", method, path, err)
+		}
+		req.Body = string(data)
+	}
+	return c.do(ctx, req, out)
+}
+
+func (c *Client) do(ctx context.Context, req *pb.CallRequest, out any) error {
+	res, err := c.api.Call(ctx, req)
+	if err != nil {
+		return err
+	}
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return newAPIError(req, res)
+	}
+	if out == nil || res.Body == "" {
+		return nil
+	}
+	if err := json.Unmarshal([]byte(res.Body), out); err != nil {
+		return fmt.Errorf("cannot decode %s %s response: %w", req.Method, req.Path, err)
+	}
+	return nil
+}
+
+// withQuery returns path with query appended, if it has any values
+func withQuery(path string, query url.Values) string {
+	if len(query) == 0 {
+		return path
+	}
+	return path + "?" + query.Encode()
+}
@@ -0,0 +1,245 @@
+package cortex
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+const (
+	customDataPath = catalogPath + "/custom-data"
+
+	// DefaultMaxBatchBytes is the largest bulk custom data request body sent unless
+	// BulkOptions.MaxBatchBytes is set
+	DefaultMaxBatchBytes = 1 << 20
+
+	// bulkOverhead is the size of a bulk request body without any entities
+	bulkOverhead = len(`{"values":{}}`)
+)
+
+// CustomData is a custom data key and value on an entity
+type CustomData struct {
+	Key         string `json:"key"`
+	Value       any    `json:"value"`
+	Description string `json:"description,omitempty"`
+}
+
+// SetCustomData sets a custom data key on the entity with tag, replacing any
+// existing value
+func (c *Client) SetCustomData(ctx context.Context, tag string, data CustomData) error {
+	return c.call(ctx, "POST", entityPath(tag)+"/custom-data", data, nil)
+}
+
+// DeleteCustomData removes the custom data key from the entity with tag
+func (c *Client) DeleteCustomData(ctx context.Context, tag string, key string) error {
+	return c.call(ctx, "DELETE", withQuery(entityPath(tag)+"/custom-data", url.Values{"key": {key}}), nil, nil)
+}
+
+// BulkOptions configures BulkSetCustomData
+type BulkOptions struct {
+	// MaxBatchBytes is the largest request body sent, DefaultMaxBatchBytes if zero
+	MaxBatchBytes int
+}
+
+// BulkResult is the outcome of BulkSetCustomData
+type BulkResult struct {
+	// Updated are the tags of the entities whose custom data was all set, sorted
+	Updated []string
+	// Failed maps the tags of the entities whose custom data was not all set to the
+	// error setting it
+	Failed map[string]error
+	// Requests is the number of requests made
+	Requests int
+}
+
+// BulkError is returned by BulkSetCustomData if the custom data of any entity was
+// not set.  It matches the errors of every failed entity with errors.Is and
+// errors.As.
+type BulkError struct {
+	Failed map[string]error
+}
+
+func (e *BulkError) Error() string {
+	tags := sortedKeys(e.Failed)
+	failures := make([]string, len(tags))
+	for i, tag := range tags {
+		failures[i] = tag + ": " + e.Failed[tag].Error()
+	}
+	return fmt.Sprintf("setting custom data failed for %d entities: %s", len(tags), strings.Join(failures, "; "))
+}
+
+func (e *BulkError) Unwrap() []error {
+	var errs []error
+	for _, tag := range sortedKeys(e.Failed) {
+		errs = append(errs, e.Failed[tag])
+	}
+	return errs
+}
+
+// BulkSetCustomData sets custom data on many entities, values maps entity tags to
+// the keys to set on them.  The values are sent in as many requests as needed to
+// keep each body under options.MaxBatchBytes, splitting an entity's keys across
+// requests if they don't fit in one.  If a request is rejected with a client error,
+// such as an unknown tag, its entities are retried one by one so the other entities
+// in it are still updated.
+//
+// The result lists which entities were updated and which failed, and a *BulkError
+// is returned if any failed.
+func (c *Client) BulkSetCustomData(ctx context.Context, values map[string][]CustomData, options BulkOptions) (*BulkResult, error) {
+	maxBytes := options.MaxBatchBytes
+	if maxBytes <= 0 {
+		maxBytes = DefaultMaxBatchBytes
+	}
+
+	result := &BulkResult{Failed: map[string]error{}}
+	batches := splitBatches(values, maxBytes, result.Failed)
+	for _, b := range batches {
+		c.sendBatch(ctx, b, maxBytes, result)
+	}
+
+	for _, tag := range sortedKeys(values) {
+		if _, failed := result.Failed[tag]; !failed {
+			result.Updated = append(result.Updated, tag)
+		}
+	}
+	if len(result.Failed) > 0 {
+		return result, &BulkError{Failed: result.Failed}
+	}
+	return result, nil
+}
+
+func (c *Client) sendBatch(ctx context.Context, b *customDataBatch, maxBytes int, result *BulkResult) {
+	if err := ctx.Err(); err != nil {
+		b.fail(err, result.Failed)
+		return
+	}
+
+	result.Requests++
+	err := c.call(ctx, "PUT", customDataPath, map[string]any{"values": b.values}, nil)
+	if err == nil {
+		return
+	}
+
+	var apiErr *APIError
+	retry := errors.As(err, &apiErr) && apiErr.StatusCode >= 400 && apiErr.StatusCode < 500 &&
+		apiErr.StatusCode != 429 && len(b.tags) > 1
+	if !retry {
+		b.fail(err, result.Failed)
+		return
+	}
+
+	// find the entities the request was rejected for
+	for _, tag := range b.tags {
+		for _, single := range splitBatches(map[string][]CustomData{tag: b.values[tag]}, maxBytes, result.Failed) {
+			c.sendBatch(ctx, single, maxBytes, result)
+		}
+	}
+}
+
+// customDataBatch is the custom data sent in a single bulk request
+type customDataBatch struct {
+	values map[string][]CustomData
+	tags   []string
+	size   int
+}
+
+func newBatch() *customDataBatch {
+	return &customDataBatch{values: map[string][]CustomData{}, size: bulkOverhead}
+}
+
+func (b *customDataBatch) add(tag string, data ...CustomData) {
+	if _, ok := b.values[tag]; !ok {
+		b.tags = append(b.tags, tag)
+		b.values[tag] = []CustomData{}
+	}
+	b.values[tag] = append(b.values[tag], data...)
+}
+
+func (b *customDataBatch) fail(err error, failed map[string]error) {
+	for _, tag := range b.tags {
+		if _, ok := failed[tag]; !ok {
+			failed[tag] = err
+		}
+	}
+}
+
+// splitBatches splits values into batches with bodies no larger than maxBytes, in
+// tag order.  Entities with values that cannot be encoded are added to failed.
+func splitBatches(values map[string][]CustomData, maxBytes int, failed map[string]error) []*customDataBatch {
+	var batches []*customDataBatch
+	current := newBatch()
+	flush := func() {
+		if len(current.tags) > 0 {
+			batches = append(batches, current)
+			current = newBatch()
+		}
+	}
+
+	for _, tag := range sortedKeys(values) {
+		data := values[tag]
+		sizes, err := encodedSizes(data)
+		if err != nil {
+			failed[tag] = fmt.Errorf("cannot encode custom data: %w", err)
+			continue
+		}
+
+		// "tag":[...], with the comma separating entities
+		encodedTag, _ := json.Marshal(tag)
+		tagSize := len(encodedTag) + 4
+		entitySize := tagSize
+		for _, size := range sizes {
+			entitySize += size + 1
+		}
+
+		if current.size+entitySize > maxBytes {
+			flush()
+		}
+		if current.size+entitySize <= maxBytes {
+			current.add(tag, data...)
+			current.size += entitySize
+			continue
+		}
+
+		// the entity doesn't fit in a request of its own, so split its values, a
+		// single value too large for any request is still sent on its own
+		for i, item := range data {
+			size := sizes[i] + 1
+			if _, ok := current.values[tag]; !ok {
+				size += tagSize
+			}
+			if current.size+size > maxBytes && len(current.tags) > 0 {
+				flush()
+				size = sizes[i] + 1 + tagSize
+			}
+			current.add(tag, item)
+			current.size += size
+		}
+	}
+	flush()
+	return batches
+}
+
+func encodedSizes(data []CustomData) ([]int, error) {
+	sizes := make([]int, len(data))
+	for i, item := range data {
+		encoded, err := json.Marshal(item)
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %w", item.Key, err)
+		}
+		sizes[i] = len(encoded)
+	}
+	return sizes, nil
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,169 @@
+package cortex
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	pb "github.com/cortexapps/axon-go/.generated/proto/github.com/cortexapps/axon"
+	"github.com/cortexapps/axon-go/mock_axon"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+	"google.golang.org/grpc"
+)
+
+type bulkBody struct {
+	Values map[string][]CustomData `json:"values"`
+}
+
+// serveBulk answers bulk custom data requests with respond, returning the decoded
+// bodies of the requests made
+func serveBulk(t *testing.T, api *mock_axon.MockCortexApiClient, respond func(body bulkBody) (int32, string)) *[]bulkBody {
+	var bodies []bulkBody
+	api.EXPECT().Call(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, req *pb.CallRequest, opts ...grpc.CallOption) (*pb.CallResponse, error) {
+			require.Equal(t, "PUT", req.Method)
+			require.Equal(t, "/api/v1/catalog/custom-data", req.Path)
+			require.Equal(t, "application/json", req.ContentType)
+
+			var body bulkBody
+			require.NoError(t, json.Unmarshal([]byte(req.Body), &body))
+			bodies = append(bodies, body)
+			code, res := respond(body)
+			return &pb.CallResponse{StatusCode: code, Body: res}, nil
+		}).AnyTimes()
+	return &bodies
+}
+
+func ok(body bulkBody) (int32, string) {
+	return 200, ""
+}
+
+func TestSetAndDeleteCustomData(t *testing.T) {
+	client, api := createClient(t)
+	expectCall(api, "POST", "/api/v1/catalog/my-service/custom-data", `{"key":"owner","value":{"team":"a"},"description":"from axon"}`, 200, `{"key":"owner"}`)
+	expectCall(api, "DELETE", "/api/v1/catalog/my-service/custom-data?key=owner+team", "", 404, `{"message":"key not found"}`)
+
+	err := client.SetCustomData(context.Background(), "my-service", CustomData{
+		Key:         "owner",
+		Value:       map[string]string{"team": "a"},
+		Description: "from axon",
+	})
+	require.NoError(t, err)
+
+	err = client.DeleteCustomData(context.Background(), "my-service", "owner team")
+	require.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestBulkSetCustomData(t *testing.T) {
+	client, api := createClient(t)
+	api.EXPECT().Call(gomock.Any(), &callMatcher{
+		method: "PUT",
+		path:   "/api/v1/catalog/custom-data",
+		body:   `{"values":{"a":[{"key":"k1","value":"v1"},{"key":"k2","value":2}],"b":[{"key":"k1","value":true}]}}`,
+	}).Return(&pb.CallResponse{StatusCode: 200}, nil)
+
+	result, err := client.BulkSetCustomData(context.Background(), map[string][]CustomData{
+		"b": {{Key: "k1", Value: true}},
+		"a": {{Key: "k1", Value: "v1"}, {Key: "k2", Value: 2}},
+	}, BulkOptions{})
+	require.NoError(t, err)
+	require.Equal(t, &BulkResult{Updated: []string{"a", "b"}, Failed: map[string]error{}, Requests: 1}, result)
+}
+
+func TestBulkSetCustomDataBatches(t *testing.T) {
+	client, api := createClient(t)
+	const maxBytes = 200
+	bodies := serveBulk(t, api, ok)
+
+	values := map[string][]CustomData{}
+	for _, tag := range []string{"a", "b", "c", "d", "e", "f"} {
+		values[tag] = []CustomData{{Key: "key", Value: "0123456789"}, {Key: "other", Value: 42}}
+	}
+	// too large for a request of its own, its keys are split across requests
+	for i := 0; i < 8; i++ {
+		values["big"] = append(values["big"], CustomData{Key: "key-" + string(rune('a'+i)), Value: "0123456789"})
+	}
+
+	result, err := client.BulkSetCustomData(context.Background(), values, BulkOptions{MaxBatchBytes: maxBytes})
+	require.NoError(t, err)
+	require.Equal(t, []string{"a", "b", "big", "c", "d", "e", "f"}, result.Updated)
+	require.Len(t, *bodies, result.Requests)
+	require.Greater(t, result.Requests, 3)
+
+	sent := map[string][]CustomData{}
+	for _, body := range *bodies {
+		encoded, err := json.Marshal(body)
+		require.NoError(t, err)
+		require.LessOrEqual(t, len(encoded), maxBytes)
+		for tag, data := range body.Values {
+			sent[tag] = append(sent[tag], data...)
+		}
+	}
+	for tag, data := range values {
+		require.Len(t, sent[tag], len(data), tag)
+	}
+}
+
+func TestBulkSetCustomDataEntityFailures(t *testing.T) {
+	client, api := createClient(t)
+	bodies := serveBulk(t, api, func(body bulkBody) (int32, string) {
+		if _, ok := body.Values["missing"]; ok {
+			return 404, `{"message":"entity missing not found"}`
+		}
+		return 200, ""
+	})
+
+	result, err := client.BulkSetCustomData(context.Background(), map[string][]CustomData{
+		"a":       {{Key: "k", Value: 1}},
+		"missing": {{Key: "k", Value: 1}},
+		"b":       {{Key: "k", Value: 1}},
+		"invalid": {{Key: "k", Value: make(chan int)}},
+	}, BulkOptions{})
+
+	// the rejected request is retried one entity at a time
+	require.Len(t, *bodies, 4)
+	require.Equal(t, 4, result.Requests)
+	require.Equal(t, []string{"a", "b"}, result.Updated)
+	require.Len(t, result.Failed, 2)
+	require.ErrorIs(t, result.Failed["missing"], ErrNotFound)
+	require.ErrorContains(t, result.Failed["invalid"], `cannot encode custom data: key "k"`)
+
+	var bulkErr *BulkError
+	require.ErrorAs(t, err, &bulkErr)
+	require.ErrorIs(t, err, ErrNotFound)
+	require.EqualError(t, err, `setting custom data failed for 2 entities: invalid: cannot encode custom data: key "k": json: unsupported type: chan int; `+
+		`missing: cortex api PUT /api/v1/catalog/custom-data: 404 Not Found: entity missing not found`)
+}
+
+func TestBulkSetCustomDataServerError(t *testing.T) {
+	client, api := createClient(t)
+	bodies := serveBulk(t, api, func(body bulkBody) (int32, string) {
+		return 503, ""
+	})
+
+	result, err := client.BulkSetCustomData(context.Background(), map[string][]CustomData{
+		"a": {{Key: "k", Value: 1}},
+		"b": {{Key: "k", Value: 1}},
+	}, BulkOptions{})
+
+	// server errors are not retried per entity
+	require.Len(t, *bodies, 1)
+	require.Empty(t, result.Updated)
+	require.ErrorIs(t, result.Failed["a"], ErrServer)
+	require.ErrorIs(t, result.Failed["b"], ErrServer)
+	require.ErrorIs(t, err, ErrServer)
+}
+
+func TestBulkSetCustomDataCancelled(t *testing.T) {
+	client, _ := createClient(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	result, err := client.BulkSetCustomData(ctx, map[string][]CustomData{
+		"a": {{Key: "k", Value: 1}},
+	}, BulkOptions{})
+	require.True(t, errors.Is(err, context.Canceled))
+	require.Equal(t, 0, result.Requests)
+}
@@ -0,0 +1,82 @@
+package cortex
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	pb "github.com/cortexapps/axon-go/.generated/proto/github.com/cortexapps/axon"
+)
+
+// Errors an *APIError matches with errors.Is, by the response status code
+var (
+	ErrBadRequest   = errors.New("bad request")
+	ErrUnauthorized = errors.New("unauthorized")
+	ErrForbidden    = errors.New("forbidden")
+	ErrNotFound     = errors.New("not found")
+	ErrConflict     = errors.New("conflict")
+	ErrRateLimited  = errors.New("rate limited")
+	ErrServer       = errors.New("server error")
+)
+
+// APIError is returned for a Cortex API response with a non-2xx status code.  Use
+// errors.Is with ErrNotFound and the other errors above to check the kind of failure.
+type APIError struct {
+	Method     string
+	Path       string
+	StatusCode int
+	// Message is the error message from the response body, if it has one
+	Message string
+	// Body is the raw response body
+	Body string
+}
+
+func newAPIError(req *pb.CallRequest, res *pb.CallResponse) *APIError {
+	e := &APIError{
+		Method:     req.Method,
+		Path:       req.Path,
+		StatusCode: int(res.StatusCode),
+		Body:       res.Body,
+	}
+
+	var body struct {
+		Message string `json:"message"`
+		Details string `json:"details"`
+	}
+	if json.Unmarshal([]byte(res.Body), &body) == nil {
+		e.Message = body.Message
+		if e.Message == "" {
+			e.Message = body.Details
+		}
+	}
+	return e
+}
+
+func (e *APIError) Error() string {
+	msg := fmt.Sprintf("cortex api %s %s: %d %s", e.Method, e.Path, e.StatusCode, http.StatusText(e.StatusCode))
+	if e.Message != "" {
+		msg += ": " + e.Message
+	}
+	return msg
+}
+
+func (e *APIError) Is(target error) bool {
+	switch target {
+	case ErrBadRequest:
+		return e.StatusCode == http.StatusBadRequest
+	case ErrUnauthorized:
+		return e.StatusCode == http.StatusUnauthorized
+	case ErrForbidden:
+		return e.StatusCode == http.StatusForbidden
+	case ErrNotFound:
+		return e.StatusCode == http.StatusNotFound
+	case ErrConflict:
+		return e.StatusCode == http.StatusConflict
+	case ErrRateLimited:
+		return e.StatusCode == http.StatusTooManyRequests
+	case ErrServer:
+		return e.StatusCode >= 500
+	}
+	return false
+}
@@ -0,0 +1,63 @@
+package cortex
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	pb "github.com/cortexapps/axon-go/.generated/proto/github.com/cortexapps/axon"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestAPIErrorIs(t *testing.T) {
+	kinds := []error{ErrBadRequest, ErrUnauthorized, ErrForbidden, ErrNotFound, ErrConflict, ErrRateLimited, ErrServer}
+	cases := map[int]error{
+		400: ErrBadRequest,
+		401: ErrUnauthorized,
+		403: ErrForbidden,
+		404: ErrNotFound,
+		409: ErrConflict,
+		429: ErrRateLimited,
+		500: ErrServer,
+		503: ErrServer,
+		422: nil,
+	}
+
+	for code, want := range cases {
+		err := error(&APIError{StatusCode: code})
+		for _, kind := range kinds {
+			require.Equal(t, kind == want, errors.Is(err, kind), "status %d is %v", code, kind)
+		}
+	}
+}
+
+func TestAPIErrorBody(t *testing.T) {
+	client, api := createClient(t)
+	expectCall(api, "GET", "/api/v1/catalog/bad", "", 502, "<html>bad gateway</html>")
+
+	_, err := client.GetEntity(context.Background(), "bad")
+	var apiErr *APIError
+	require.ErrorAs(t, err, &apiErr)
+	require.Equal(t, &APIError{
+		Method:     "GET",
+		Path:       "/api/v1/catalog/bad",
+		StatusCode: 502,
+		Body:       "<html>bad gateway</html>",
+	}, apiErr)
+	require.EqualError(t, err, "cortex api GET /api/v1/catalog/bad: 502 Bad Gateway")
+}
+
+func TestCallErrorsArePassedThrough(t *testing.T) {
+	client, api := createClient(t)
+	api.EXPECT().Call(gomock.Any(), gomock.Any()).Return(nil, status.Error(codes.Unavailable, "agent is down"))
+	api.EXPECT().Call(gomock.Any(), gomock.Any()).Return(&pb.CallResponse{StatusCode: 200, Body: "not json"}, nil)
+
+	_, err := client.GetEntity(context.Background(), "my-service")
+	require.Equal(t, codes.Unavailable, status.Code(err))
+
+	_, err = client.GetEntity(context.Background(), "my-service")
+	require.ErrorContains(t, err, "cannot decode GET /api/v1/catalog/my-service response")
+}
@@ -0,0 +1,168 @@
+package axon
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	pb "github.com/cortexapps/axon-go/.generated/proto/github.com/cortexapps/axon"
+	"go.uber.org/zap"
+)
+
+// EndpointMode controls how handlers are registered when the agent is given
+// several endpoints with WithEndpoints
+type EndpointMode int
+
+const (
+	// EndpointFailover registers handlers only with the endpoint serving the
+	// dispatch stream, registering them with the next endpoint on failover
+	EndpointFailover EndpointMode = iota
+	// EndpointRegisterAll registers handlers with every endpoint up front, so a
+	// standby already knows the handlers when the dispatch stream fails over
+	EndpointRegisterAll
+)
+
+func (m EndpointMode) String() string {
+	switch m {
+	case EndpointFailover:
+		return "failover"
+	case EndpointRegisterAll:
+		return "register-all"
+	}
+	return fmt.Sprintf("EndpointMode(%d)", int(m))
+}
+
+// endpoint is an agent the SDK can connect to
+type endpoint struct {
+	target string
+	client grpcClient
+}
+
+// activeClient returns the client for the endpoint currently serving the dispatch stream
+func (a *Agent) activeClient() grpcClient {
+	a.clientMu.RLock()
+	defer a.clientMu.RUnlock()
+	return a.client
+}
+
+// nextEndpoint moves the dispatch stream to the next endpoint after a failure.  It
+// returns true if that endpoint should be tried straight away, or false once every
+// endpoint has failed since the last successful connection and the caller should
+// back off before retrying.
+func (a *Agent) nextEndpoint() bool {
+	if len(a.endpoints) < 2 {
+		return false
+	}
+
+	a.clientMu.Lock()
+	a.activeEndpoint = (a.activeEndpoint + 1) % len(a.endpoints)
+	next := a.endpoints[a.activeEndpoint]
+	a.client = next.client
+	a.clientMu.Unlock()
+
+	a.logger.Warn("failing over to agent endpoint", zap.String("target", next.target))
+	a.failedEndpoints++
+	return a.failedEndpoints < len(a.endpoints)
+}
+
+// registerWithStandbys registers the handler with every endpoint other than the
+// active one it is not already registered with.  Standbys never get a handler's
+// schedule, so a scheduled handler only fires from the active endpoint.  Failures
+// are only logged, the handler is registered again if the dispatch stream fails
+// over to that endpoint.  handlersMu must be held.
+func (a *Agent) registerWithStandbys(ctx context.Context, info *handlerInfo) {
+	options := withoutSchedule(info.options)
+	if len(options) == 0 {
+		return
+	}
+
+	active := a.activeClient()
+	for _, ep := range a.endpoints {
+		if ep.client == active || a.registeredOn(info, ep.client) {
+			continue
+		}
+		if _, err := a.registerHandlerWith(ctx, ep.client, info, options); err != nil {
+			a.logger.Warn("failed to register handler with standby endpoint",
+				zap.String("handler", info.name),
+				zap.String("target", ep.target),
+				zap.Error(err),
+			)
+		}
+	}
+}
+
+// registeredOn returns true if the handler is registered with client, handlersMu
+// must be held
+func (a *Agent) registeredOn(info *handlerInfo, client grpcClient) bool {
+	for id, h := range a.registeredHandlers {
+		if h == info && a.registeredWith[id] == client {
+			return true
+		}
+	}
+	return false
+}
+
+// unregisterStale retries unregistering the scheduled registrations that could not
+// be unregistered before, e.g. left on endpoints that could not be reached when the
+// dispatch stream moved away from them.  It returns an error if one is left on the
+// active endpoint, where it would keep firing.  handlersMu must be held.
+func (a *Agent) unregisterStale(ctx context.Context) error {
+	active := a.activeClient()
+	var errs error
+	for id, client := range a.staleRegistrations {
+		err := a.unregisterWith(ctx, client, id)
+		if err == nil {
+			delete(a.staleRegistrations, id)
+		} else if client == active {
+			errs = errors.Join(errs, err)
+		}
+	}
+	return errs
+}
+
+// withoutSchedule returns options without the invoke options fired on a schedule,
+// along with RUN_NOW which belongs to it
+func withoutSchedule(options []*pb.HandlerOption) []*pb.HandlerOption {
+	var unscheduled []*pb.HandlerOption
+	for _, option := range options {
+		if isScheduledOption(option) || option.GetInvoke().GetType() == pb.HandlerInvokeType_RUN_NOW {
+			continue
+		}
+		unscheduled = append(unscheduled, option)
+	}
+	return unscheduled
+}
+
+const recentInvocationsSize = 1024
+
+// recentInvocations remembers the ids of the most recently dispatched invocations,
+// so an invocation delivered twice, e.g. redelivered after failing over, only runs
+// once.  It is only used from the dispatch loop, and being in memory it does not
+// dedupe invocations delivered to other processes.
+type recentInvocations struct {
+	ids   map[string]struct{}
+	order []string
+	next  int
+}
+
+func newRecentInvocations(size int) *recentInvocations {
+	return &recentInvocations{
+		ids:   make(map[string]struct{}, size),
+		order: make([]string, size),
+	}
+}
+
+// add records id, returning false if it has already been seen
+func (r *recentInvocations) add(id string) bool {
+	if _, ok := r.ids[id]; ok {
+		return false
+	}
+
+	if evicted := r.order[r.next]; evicted != "" {
+		delete(r.ids, evicted)
+	}
+	r.order[r.next] = id
+	r.next = (r.next + 1) % len(r.order)
+	r.ids[id] = struct{}{}
+	return true
+}
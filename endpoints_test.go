@@ -0,0 +1,345 @@
+package axon
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	pb "github.com/cortexapps/axon-go/.generated/proto/github.com/cortexapps/axon"
+	"github.com/cortexapps/axon-go/mock_axon"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func createMultiEndpointAgent(controller *gomock.Controller, mode EndpointMode, options ...Option) (*Agent, []*mockGrpcClient) {
+	options = append([]Option{
+		WithBackoff(ConstantBackoff(time.Millisecond)),
+		WithEndpoints(mode, "agent-0:50051", "agent-1:50051"),
+	}, options...)
+	agent := NewAxonAgent(options...)
+
+	var mocks []*mockGrpcClient
+	agent.endpoints = nil
+	for range 2 {
+		mock := &mockGrpcClient{
+			apiStub:   mock_axon.NewMockCortexApiClient(controller),
+			agentStub: mock_axon.NewMockAxonAgentClient(controller),
+		}
+		mocks = append(mocks, mock)
+		agent.endpoints = append(agent.endpoints, endpoint{target: "agent", client: mock})
+	}
+	agent.client = mocks[0]
+	return agent, mocks
+}
+
+func workCompletedStream(messages ...*pb.DispatchMessage) *mockBidiClient {
+	return newBidiClient(append(messages, &pb.DispatchMessage{
+		Type: pb.DispatchMessageType_DISPATCH_MESSAGE_WORK_COMPLETED,
+	})...)
+}
+
+func invokeMessage(handlerId string, invocationId string) *pb.DispatchMessage {
+	return &pb.DispatchMessage{
+		Type: pb.DispatchMessageType_DISPATCH_MESSAGE_INVOKE,
+		Message: &pb.DispatchMessage_Invoke{
+			Invoke: &pb.DispatchHandlerInvoke{
+				InvocationId: invocationId,
+				HandlerId:    handlerId,
+				HandlerName:  "syncHandler",
+				Reason:       pb.HandlerInvokeType_INVOKE,
+			},
+		},
+	}
+}
+
+func TestWithEndpoints(t *testing.T) {
+	agent := NewAxonAgent(WithEndpoints(EndpointRegisterAll, "agent-0:50051", "unix:/var/run/axon.sock"))
+	require.Len(t, agent.endpoints, 2)
+	require.Equal(t, "agent-0:50051", agent.endpoints[0].target)
+	require.Equal(t, "unix:/var/run/axon.sock", agent.endpoints[1].target)
+	require.Equal(t, agent.endpoints[0].client, agent.client)
+	require.Equal(t, EndpointRegisterAll, agent.endpointMode)
+
+	agent = NewAxonAgent()
+	require.Len(t, agent.endpoints, 1)
+	require.Equal(t, "localhost:50051", agent.endpoints[0].target)
+}
+
+func TestFailoverToNextEndpoint(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+
+	var states []ConnectionState
+	agent, mocks := createMultiEndpointAgent(controller, EndpointFailover,
+		WithConnectionStateHook(func(from, to ConnectionState) {
+			states = append(states, to)
+		}),
+	)
+
+	mocks[0].agentStub.EXPECT().RegisterHandler(gomock.Any(), gomock.Any()).Return(&pb.RegisterHandlerResponse{Id: "a-1"}, nil)
+	_, err := agent.RegisterHandler(syncHandler, WithInvokeOption(pb.HandlerInvokeType_INVOKE, ""))
+	require.NoError(t, err)
+
+	// the primary is down, so the handler is registered with the second endpoint
+	// and the invocation it dispatches is reported back to it
+	mocks[0].agentStub.EXPECT().Dispatch(gomock.Any(), gomock.Any()).Return(nil, status.Error(codes.Unavailable, "agent is down"))
+	mocks[1].agentStub.EXPECT().RegisterHandler(gomock.Any(), gomock.Any()).Return(&pb.RegisterHandlerResponse{Id: "b-1"}, nil)
+	mocks[1].agentStub.EXPECT().Dispatch(gomock.Any(), gomock.Any()).Return(workCompletedStream(invokeMessage("b-1", "inv-1")), nil)
+	mocks[1].agentStub.EXPECT().ReportInvocation(gomock.Any(), gomock.Any(), gomock.Any()).Return(&pb.ReportInvocationResponse{}, nil)
+
+	require.NoError(t, agent.Run(context.Background()))
+	require.Equal(t, mocks[1], agent.client)
+	require.Equal(t, []ConnectionState{ConnectionConnecting, ConnectionConnected, ConnectionIdle}, states)
+
+	// the registration with the failed endpoint is kept until we fail back to it
+	require.Equal(t, mocks[0], agent.registeredWith["a-1"])
+	require.Equal(t, mocks[1], agent.registeredWith["b-1"])
+}
+
+func TestFailoverBacksOffAfterEveryEndpointFails(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+
+	var gaveUp error
+	agent, mocks := createMultiEndpointAgent(controller, EndpointFailover,
+		WithBackoff(BackoffPolicy{
+			InitialInterval: time.Millisecond,
+			MaxInterval:     time.Millisecond,
+			Multiplier:      1,
+			MaxElapsedTime:  time.Nanosecond,
+			OnGiveUp: func(err error) {
+				gaveUp = err
+			},
+		}),
+	)
+
+	dispatchErr := status.Error(codes.Unavailable, "agent is down")
+	mocks[0].agentStub.EXPECT().Dispatch(gomock.Any(), gomock.Any()).Return(nil, dispatchErr)
+	mocks[1].agentStub.EXPECT().Dispatch(gomock.Any(), gomock.Any()).Return(nil, dispatchErr)
+
+	err := agent.Run(context.Background())
+	require.ErrorIs(t, err, dispatchErr)
+	require.ErrorIs(t, gaveUp, dispatchErr)
+}
+
+func TestRegisterWithAllEndpoints(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+	agent, mocks := createMultiEndpointAgent(controller, EndpointRegisterAll)
+
+	mocks[0].agentStub.EXPECT().RegisterHandler(gomock.Any(), gomock.Any()).Return(&pb.RegisterHandlerResponse{Id: "a-1"}, nil)
+	mocks[1].agentStub.EXPECT().RegisterHandler(gomock.Any(), gomock.Any()).Return(&pb.RegisterHandlerResponse{Id: "b-1"}, nil)
+
+	id, err := agent.RegisterHandler(syncHandler, WithInvokeOption(pb.HandlerInvokeType_INVOKE, ""))
+	require.NoError(t, err)
+	require.Equal(t, "a-1", id)
+	require.Len(t, agent.registeredHandlers, 2)
+
+	// unregistering removes the handler from every endpoint
+	mocks[0].agentStub.EXPECT().UnregisterHandler(gomock.Any(), &pb.UnregisterHandlerRequest{Id: "a-1"}).Return(&pb.UnregisterHandlerResponse{}, nil)
+	mocks[1].agentStub.EXPECT().UnregisterHandler(gomock.Any(), &pb.UnregisterHandlerRequest{Id: "b-1"}).Return(&pb.UnregisterHandlerResponse{}, nil)
+	require.NoError(t, agent.UnregisterHandler(id))
+	require.Empty(t, agent.registeredHandlers)
+	require.Empty(t, agent.registeredWith)
+}
+
+func TestRegisterWithAllEndpointsToleratesStandbyFailure(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+	agent, mocks := createMultiEndpointAgent(controller, EndpointRegisterAll)
+
+	mocks[0].agentStub.EXPECT().RegisterHandler(gomock.Any(), gomock.Any()).Return(&pb.RegisterHandlerResponse{Id: "a-1"}, nil)
+	mocks[1].agentStub.EXPECT().RegisterHandler(gomock.Any(), gomock.Any()).Return(nil, status.Error(codes.Unavailable, "agent is down"))
+
+	id, err := agent.RegisterHandler(syncHandler, WithInvokeOption(pb.HandlerInvokeType_INVOKE, ""))
+	require.NoError(t, err)
+	require.Equal(t, "a-1", id)
+	require.Len(t, agent.registeredHandlers, 1)
+}
+
+// fakeEndpoint is an agent endpoint that keeps the handlers registered with it.
+// Each connection to it gets a single tick of its schedule, which fires every
+// scheduled registration, then fails so the agent fails over.
+type fakeEndpoint struct {
+	mu            sync.Mutex
+	name          string
+	down          bool
+	registrations map[string][]*pb.HandlerOption
+	nextId        int
+}
+
+// serveFakeEndpoint serves the endpoint from mock, calling connected after every
+// connection.  The connection completes the work if connected returns true.
+func serveFakeEndpoint(mock *mockGrpcClient, name string, connected func() bool) *fakeEndpoint {
+	f := &fakeEndpoint{name: name, registrations: map[string][]*pb.HandlerOption{}}
+	unavailable := status.Error(codes.Unavailable, name+" is down")
+
+	mock.agentStub.EXPECT().RegisterHandler(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, req *pb.RegisterHandlerRequest, opts ...any) (*pb.RegisterHandlerResponse, error) {
+			f.mu.Lock()
+			defer f.mu.Unlock()
+			if f.down {
+				return nil, unavailable
+			}
+			f.nextId++
+			id := fmt.Sprintf("%s-%d", f.name, f.nextId)
+			f.registrations[id] = req.Options
+			return &pb.RegisterHandlerResponse{Id: id}, nil
+		}).AnyTimes()
+	mock.agentStub.EXPECT().UnregisterHandler(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, req *pb.UnregisterHandlerRequest, opts ...any) (*pb.UnregisterHandlerResponse, error) {
+			f.mu.Lock()
+			defer f.mu.Unlock()
+			if f.down {
+				return nil, unavailable
+			}
+			delete(f.registrations, req.Id)
+			return &pb.UnregisterHandlerResponse{}, nil
+		}).AnyTimes()
+	mock.agentStub.EXPECT().Dispatch(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, opts ...any) (pb.AxonAgent_DispatchClient, error) {
+			f.mu.Lock()
+			if f.down {
+				f.mu.Unlock()
+				return nil, unavailable
+			}
+			var messages []*pb.DispatchMessage
+			for _, id := range f.scheduled() {
+				messages = append(messages, invokeMessage(id, id+"-tick"))
+			}
+			f.mu.Unlock()
+
+			if connected() {
+				return workCompletedStream(messages...), nil
+			}
+			stream := newBidiClient(messages...)
+			stream.eofOnFinish = true
+			return stream, nil
+		}).AnyTimes()
+	mock.agentStub.EXPECT().ReportInvocation(gomock.Any(), gomock.Any(), gomock.Any()).Return(&pb.ReportInvocationResponse{}, nil).AnyTimes()
+	return f
+}
+
+// scheduled returns the ids of the scheduled registrations, f.mu must be held
+func (f *fakeEndpoint) scheduled() []string {
+	var ids []string
+	for id, options := range f.registrations {
+		for _, option := range options {
+			if isScheduledOption(option) {
+				ids = append(ids, id)
+			}
+		}
+	}
+	return ids
+}
+
+func (f *fakeEndpoint) setDown(down bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.down = down
+}
+
+// firedPerTick returns the number of invocations the endpoints that are up fire
+// each tick
+func firedPerTick(endpoints ...*fakeEndpoint) int {
+	fired := 0
+	for _, f := range endpoints {
+		f.mu.Lock()
+		if !f.down {
+			fired += len(f.scheduled())
+		}
+		f.mu.Unlock()
+	}
+	return fired
+}
+
+func TestScheduledHandlerRunsOncePerTickAcrossEndpoints(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+	agent, mocks := createMultiEndpointAgent(controller, EndpointRegisterAll)
+
+	var first, second *fakeEndpoint
+	var fired []int
+	connections := 0
+	connected := func() bool {
+		fired = append(fired, firedPerTick(first, second))
+		connections++
+		switch connections {
+		case 1:
+			// fail back to the first endpoint while the second is down
+			first.setDown(false)
+			second.setDown(true)
+		case 2:
+			// and over to the second again while the first is down
+			second.setDown(false)
+			first.setDown(true)
+		}
+		return connections == 3
+	}
+	first = serveFakeEndpoint(mocks[0], "a", connected)
+	second = serveFakeEndpoint(mocks[1], "b", connected)
+
+	var runs atomic.Int32
+	_, err := agent.RegisterHandler(func(ctx HandlerContext) error {
+		runs.Add(1)
+		return nil
+	}, WithName("syncHandler"),
+		WithInvokeOption(pb.HandlerInvokeType_RUN_INTERVAL, "1s"),
+		WithInvokeOption(pb.HandlerInvokeType_INVOKE, ""),
+	)
+	require.NoError(t, err)
+
+	// the standby can invoke the handler but does not get its schedule
+	require.Equal(t, 1, firedPerTick(first, second))
+	require.Len(t, second.registrations, 1)
+
+	// each failover moves the schedule to the endpoint failed over to, removing
+	// it from the previous endpoint once it can be reached
+	first.setDown(true)
+	require.NoError(t, agent.Run(context.Background()))
+	require.Equal(t, []int{1, 1, 1}, fired)
+	require.Equal(t, int32(3), runs.Load())
+	require.Equal(t, mocks[1], agent.client)
+	require.Len(t, second.registrations, 1)
+}
+
+func TestDuplicateInvocationRunsOnce(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+	agent, mock := createAgent(controller)
+
+	var calls atomic.Int32
+	mock.agentStub.EXPECT().RegisterHandler(gomock.Any(), gomock.Any()).Return(&pb.RegisterHandlerResponse{Id: "1"}, nil)
+	_, err := agent.RegisterHandler(func(ctx HandlerContext) error {
+		calls.Add(1)
+		return nil
+	}, WithName("syncHandler"), WithInvokeOption(pb.HandlerInvokeType_INVOKE, ""))
+	require.NoError(t, err)
+
+	mock.agentStub.EXPECT().Dispatch(gomock.Any(), gomock.Any()).Return(workCompletedStream(
+		invokeMessage("1", "inv-1"),
+		invokeMessage("1", "inv-1"),
+		invokeMessage("1", "inv-2"),
+	), nil)
+	mock.agentStub.EXPECT().ReportInvocation(gomock.Any(), gomock.Any(), gomock.Any()).Times(2).Return(&pb.ReportInvocationResponse{}, nil)
+
+	require.NoError(t, agent.Run(context.Background()))
+	require.Equal(t, int32(2), calls.Load())
+}
+
+func TestRecentInvocations(t *testing.T) {
+	recent := newRecentInvocations(2)
+	require.True(t, recent.add("1"))
+	require.False(t, recent.add("1"))
+	require.True(t, recent.add("2"))
+	require.True(t, recent.add("3"))
+
+	// the oldest id has been forgotten
+	require.True(t, recent.add("1"))
+	require.False(t, recent.add("3"))
+}
@@ -0,0 +1,67 @@
+package axon
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// Error codes reported to the agent when a handler invocation fails
+const (
+	ErrorCodeUnexpected  = "unexpected"
+	ErrorCodeTimeout     = "timeout"
+	ErrorCodeInvalidArgs = "invalid_args"
+	ErrorCodeEncoding    = "encoding_error"
+	ErrorCodeRejected    = "rejected"
+	ErrorCodeDropped     = "dropped"
+	ErrorCodeSkipped     = "skipped"
+	ErrorCodeShutdown    = "shutdown"
+	ErrorCodeCancelled   = "cancelled"
+)
+
+// HandlerError is an error that carries the code that is reported to the
+// agent for a failed invocation.  Handlers can return one to control the
+// code, other errors are reported as ErrorCodeUnexpected unless they wrap a
+// context cancellation or deadline
+type HandlerError struct {
+	Code string
+	Err  error
+}
+
+// NewHandlerError wraps err with the specified error code
+func NewHandlerError(code string, err error) *HandlerError {
+	return &HandlerError{
+		Code: code,
+		Err:  err,
+	}
+}
+
+func (e *HandlerError) Error() string {
+	if e.Err == nil {
+		return e.Code
+	}
+	return e.Err.Error()
+}
+
+func (e *HandlerError) Unwrap() error {
+	return e.Err
+}
+
+func errorCode(err error) string {
+	var handlerErr *HandlerError
+	if errors.As(err, &handlerErr) && handlerErr.Code != "" {
+		return handlerErr.Code
+	}
+	// handlers returning their context's error were cancelled or timed out
+	if errors.Is(err, context.Canceled) {
+		return ErrorCodeCancelled
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return ErrorCodeTimeout
+	}
+	return ErrorCodeUnexpected
+}
+
+func invalidArgsError(format string, args ...any) error {
+	return NewHandlerError(ErrorCodeInvalidArgs, fmt.Errorf(format, args...))
+}
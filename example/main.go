@@ -2,19 +2,22 @@ package main
 
 import (
 	"context"
-	"encoding/json"
 	"log"
 	"time"
 
 	"github.com/cortexapps/axon-go"
 	pb "github.com/cortexapps/axon-go/.generated/proto/github.com/cortexapps/axon"
+	"github.com/cortexapps/axon-go/cortex"
 	"go.uber.org/zap"
 )
 
 func main() {
 
-	// create our agent client and register a handler
-	agentClient := axon.NewAxonAgent()
+	// create our agent client and register a handler, on SIGTERM or SIGINT
+	// running handlers get up to 30 seconds to finish
+	agentClient := axon.NewAxonAgent(
+		axon.WithShutdownSignals(30 * time.Second),
+	)
 
 	// this handler will be invoked every 5 seconds
 	_, err := agentClient.RegisterHandler(myExampleIntervalHandler,
@@ -57,41 +60,15 @@ func main() {
 // Here we have our example handler that will be called every one second
 func myExampleIntervalHandler(ctx axon.HandlerContext) error {
 
-	// here you would do some operations that then push data to the cortex api
-	//
-	// JSON payload to send to the Cortex API is like:
-	// {
-	// 	"values": {
-	// 	  "service-tag": [
-	// 		{
-	// 		  "key": "k1",
-	// 		  "value": "v1"
-	// 		},
-	// 		{
-	// 		  "key": "k2",
-	// 		  "value": "v2"
-	// 		}
-	// 	  ],
-	// 	}
-
-	payload := map[string]interface{}{
-		"values": map[string]interface{}{
-			"my-service": []interface{}{
-				map[string]string{
-					"key":   "my-custom-key",
-					"value": "my-custom-value",
-				},
-			},
+	// here you would do some operations that then push data to the cortex api,
+	// keyed by the tag of the entity to set the custom data on
+	values := map[string][]cortex.CustomData{
+		"my-service": {
+			{Key: "my-custom-key", Value: "my-custom-value"},
 		},
 	}
 
-	json, err := json.Marshal(payload)
-	if err != nil {
-		ctx.Logger().Error("Error marshalling json", zap.Error(err))
-		return nil
-	}
-
-	_, err = ctx.CortexJsonApiCall("PUT", "/api/v1/catalog/custom-data", string(json))
+	_, err := axon.CortexClient(ctx).BulkSetCustomData(ctx, values, cortex.BulkOptions{})
 	if err != nil {
 		ctx.Logger().Error("Error calling cortex api", zap.Error(err))
 	}
@@ -110,16 +87,11 @@ func myExampleWebhookHandler(ctx axon.HandlerContext) error {
 	return nil
 }
 
-// Here is a handler that can be invoked from server side, must return string or nil
+// Here is a handler that can be invoked from server side, the returned value
+// is encoded as JSON
 func myExampleInvokeHandler(ctx axon.HandlerContext) (any, error) {
 	result := map[string]any{
 		"message": "Hello from myExampleInvokeHandler!",
 	}
-
-	json, err := json.Marshal(result)
-	if err != nil {
-		ctx.Logger().Error("Error marshalling json", zap.Error(err))
-		return nil, err
-	}
-	return string(json), nil
+	return result, nil
 }
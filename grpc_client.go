@@ -1,11 +1,10 @@
 package axon
 
 import (
-	"fmt"
-
 	pb "github.com/cortexapps/axon-go/.generated/proto/github.com/cortexapps/axon"
 	"go.uber.org/zap"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/credentials/insecure"
 )
 
@@ -17,8 +16,9 @@ type grpcClient interface {
 }
 
 type grpcClientImpl struct {
-	host          string
-	port          int
+	target        string
+	tlsConfig     *TLSConfig
+	dialOptions   []grpc.DialOption
 	conn          *grpc.ClientConn
 	stub          pb.AxonAgentClient
 	apiClientStub pb.CortexApiClient
@@ -26,24 +26,39 @@ type grpcClientImpl struct {
 	logger *zap.Logger
 }
 
-func newGrpcClient(host string, port int, logger *zap.Logger) grpcClient {
+func newGrpcClient(target string, tlsConfig *TLSConfig, dialOptions []grpc.DialOption, logger *zap.Logger) grpcClient {
 	return &grpcClientImpl{
-		host:   host,
-		port:   port,
-		logger: logger,
+		target:      target,
+		tlsConfig:   tlsConfig,
+		dialOptions: dialOptions,
+		logger:      logger,
+	}
+}
+
+func (c *grpcClientImpl) transportCredentials() (credentials.TransportCredentials, error) {
+	if c.tlsConfig == nil {
+		return insecure.NewCredentials(), nil
 	}
+	return c.tlsConfig.transportCredentials()
 }
 
 func (c *grpcClientImpl) getConnection() *grpc.ClientConn {
 
 	if c.conn == nil {
 
-		conn, err := grpc.NewClient(
-			fmt.Sprintf("%s:%d", c.host, c.port),
-			grpc.WithTransportCredentials(insecure.NewCredentials()))
+		creds, err := c.transportCredentials()
+		if err != nil {
+			c.logger.Error("failed to load TLS credentials", zap.Error(err))
+			return nil
+		}
+
+		// both stubs share this connection, so the caller's dial options and
+		// interceptors apply to agent and api calls alike
+		options := append([]grpc.DialOption{grpc.WithTransportCredentials(creds)}, c.dialOptions...)
+		conn, err := grpc.NewClient(c.target, options...)
 
 		if err != nil {
-			c.logger.Error("failed to create connection to agent", zap.Error(err))
+			c.logger.Error("failed to create connection to agent", zap.String("target", c.target), zap.Error(err))
 			return nil
 		}
 		c.conn = conn
@@ -0,0 +1,106 @@
+package axon
+
+import (
+	"context"
+	"net"
+	"path/filepath"
+	"testing"
+
+	pb "github.com/cortexapps/axon-go/.generated/proto/github.com/cortexapps/axon"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+)
+
+func TestAgentTarget(t *testing.T) {
+	cases := []struct {
+		name   string
+		opts   []Option
+		target string
+	}{
+		{"default", nil, "localhost:50051"},
+		{"hostport", []Option{WithHostport("axon", 8080)}, "axon:8080"},
+		{"ipv6 hostport", []Option{WithHostport("::1", 8080)}, "[::1]:8080"},
+		{"target", []Option{WithTarget("dns:///axon:50051")}, "dns:///axon:50051"},
+		{"unix socket", []Option{WithUnixSocket("/var/run/axon.sock")}, "unix:/var/run/axon.sock"},
+		{"last wins", []Option{WithTarget("dns:///axon:50051"), WithHostport("axon", 8080)}, "axon:8080"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			ao := defaultAgentOptions()
+			for _, opt := range tc.opts {
+				opt(ao)
+			}
+			require.Equal(t, tc.target, ao.target)
+		})
+	}
+}
+
+func TestUnixSocketConnection(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "axon.sock")
+	listener, err := net.Listen("unix", socket)
+	require.NoError(t, err)
+
+	impl := &tlsTestServer{clientNames: make(chan string, 1)}
+	s := grpc.NewServer()
+	pb.RegisterAxonAgentServer(s, impl)
+	go s.Serve(listener)
+	t.Cleanup(s.Stop)
+
+	agent := NewAxonAgent(WithUnixSocket(socket))
+	_, err = agent.client.agent().ListHandlers(context.Background(), &pb.ListHandlersRequest{})
+	require.NoError(t, err)
+	<-impl.clientNames
+}
+
+func TestClientInterceptors(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "axon.sock")
+	listener, err := net.Listen("unix", socket)
+	require.NoError(t, err)
+
+	impl := &tlsTestServer{clientNames: make(chan string, 1)}
+	s := grpc.NewServer()
+	pb.RegisterAxonAgentServer(s, impl)
+	pb.RegisterCortexApiServer(s, &pb.UnimplementedCortexApiServer{})
+	go s.Serve(listener)
+	t.Cleanup(s.Stop)
+
+	var calls []string
+	unary := func(name string) grpc.UnaryClientInterceptor {
+		return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+			calls = append(calls, name+" "+method)
+			return invoker(ctx, method, req, reply, cc, opts...)
+		}
+	}
+	stream := func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		calls = append(calls, "stream "+method)
+		return streamer(ctx, desc, cc, method, opts...)
+	}
+
+	agent := NewAxonAgent(
+		WithUnixSocket(socket),
+		WithUnaryInterceptor(unary("first"), unary("second")),
+		WithStreamInterceptor(stream),
+		WithDialOptions(grpc.WithUserAgent("axon-test")),
+	)
+
+	_, err = agent.client.agent().ListHandlers(context.Background(), &pb.ListHandlersRequest{})
+	require.NoError(t, err)
+	<-impl.clientNames
+
+	_, err = agent.client.api().Call(context.Background(), &pb.CallRequest{Method: "GET", Path: "/api/v1/catalog"})
+	require.Error(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	_, err = agent.client.agent().Dispatch(ctx)
+	require.NoError(t, err)
+
+	require.Equal(t, []string{
+		"first " + pb.AxonAgent_ListHandlers_FullMethodName,
+		"second " + pb.AxonAgent_ListHandlers_FullMethodName,
+		"first " + pb.CortexApi_Call_FullMethodName,
+		"second " + pb.CortexApi_Call_FullMethodName,
+		"stream " + pb.AxonAgent_Dispatch_FullMethodName,
+	}, calls)
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 
 	pb "github.com/cortexapps/axon-go/.generated/proto/github.com/cortexapps/axon"
+	"github.com/cortexapps/axon-go/cortex"
 	"go.uber.org/zap"
 )
 
@@ -11,6 +12,7 @@ type handlerContextKey string
 
 const apiKey handlerContextKey = "api"
 const logKey handlerContextKey = "log"
+const invokeKey handlerContextKey = "invoke"
 
 type HandlerContext interface {
 	context.Context
@@ -20,6 +22,15 @@ type HandlerContext interface {
 	Logger() *zap.Logger
 }
 
+// CortexClient returns a typed client for the Cortex API, making its calls with
+// ctx.Api().  A HandlerContext can supply its own client with a Cortex method.
+func CortexClient(ctx HandlerContext) *cortex.Client {
+	if c, ok := ctx.(interface{ Cortex() *cortex.Client }); ok {
+		return c.Cortex()
+	}
+	return cortex.NewClient(ctx.Api())
+}
+
 type handlerContext struct {
 	context.Context
 	args map[string]string
@@ -45,20 +56,38 @@ func (h *handlerContext) CortexJsonApiCall(method string, path string, jsonBody
 	})
 }
 
+func (h *handlerContext) Cortex() *cortex.Client {
+	return cortex.NewClient(h.Api())
+}
+
 func (h *handlerContext) Logger() *zap.Logger {
 	return h.Value(logKey).(*zap.Logger)
 }
 
 func NewHandlerContext(invoke *pb.DispatchHandlerInvoke, ctx context.Context, api pb.CortexApiClient, logger *zap.Logger) HandlerContext {
+	return newHandlerContext(invoke, ctx, api, logger.With(handlerNameField(invoke)))
+}
 
-	name := invoke.HandlerName
-	logger = logger.With(zap.String("handler-name", name))
+func handlerNameField(invoke *pb.DispatchHandlerInvoke) zap.Field {
+	return zap.String("handler-name", invoke.HandlerName)
+}
 
+// newHandlerContext is NewHandlerContext without tagging the logger with the handler
+// name, for loggers that only tag some of their outputs
+func newHandlerContext(invoke *pb.DispatchHandlerInvoke, ctx context.Context, api pb.CortexApiClient, logger *zap.Logger) HandlerContext {
 	ctx = context.WithValue(ctx, logKey, logger)
 	ctx = context.WithValue(ctx, apiKey, api)
+	ctx = context.WithValue(ctx, invokeKey, invoke)
 
 	return &handlerContext{
 		Context: ctx,
 		args:    invoke.Args,
 	}
 }
+
+// InvokeFromContext returns the invocation a handler context was created for, such
+// as its handler name and reason, or nil if ctx is not a handler context
+func InvokeFromContext(ctx context.Context) *pb.DispatchHandlerInvoke {
+	invoke, _ := ctx.Value(invokeKey).(*pb.DispatchHandlerInvoke)
+	return invoke
+}
@@ -0,0 +1,71 @@
+package axon
+
+import (
+	"fmt"
+	"reflect"
+	"runtime"
+	"strings"
+)
+
+// resolveHandlerName returns the name a handler is registered with along with
+// the package that declares it and the symbol of the function the name was derived
+// from.  The package and symbol are empty for handlers named explicitly with WithName.
+func resolveHandlerName(fn any, opts *registerHandlerOptions) (pkg string, name string, symbol string, err error) {
+
+	if opts.name != "" {
+		name = opts.name
+	} else {
+		pkg, name = handlerFuncName(fn)
+		if name == "" {
+			return "", "", "", fmt.Errorf("unable to derive a name for handler %T, use WithName", fn)
+		}
+		symbol = funcSymbol(fn)
+	}
+
+	if opts.namespace != "" {
+		name = opts.namespace + "." + name
+	}
+	return pkg, name, symbol, nil
+}
+
+// handlerFuncName derives the name of a handler function from the last element of
+// its symbol name.  Handler history is keyed by name, so this keeps the names
+// handlers have always been registered with, even where they are ambiguous:
+//
+//	github.com/org/pkg.sync                   -> sync
+//	github.com/org/pkg.(*Syncer).Sync-fm      -> Sync-fm
+//	github.com/org/pkg.main.func1             -> func1
+//	github.com/org/pkg.Sync[...]              -> Sync
+//
+// Closures and method values in different functions or types can share a name, so
+// registering both is an error asking for WithName rather than a silent collision.
+func handlerFuncName(fn any) (pkg string, name string) {
+	symbol := funcSymbol(fn)
+	if symbol == "" {
+		return "", ""
+	}
+
+	// the package path ends at the first dot after the last slash
+	lastSlash := strings.LastIndex(symbol, "/")
+	dot := strings.Index(symbol[lastSlash+1:], ".")
+	if dot < 0 {
+		return "", symbol
+	}
+	pkg = symbol[:lastSlash+1+dot]
+	name = strings.ReplaceAll(symbol[lastSlash+1+dot+1:], "[...]", "")
+	return pkg, name[strings.LastIndex(name, ".")+1:]
+}
+
+// funcSymbol returns the symbol name of the function fn, or "" if fn is not a function
+func funcSymbol(fn any) string {
+	v := reflect.ValueOf(fn)
+	if v.Kind() != reflect.Func || v.IsNil() {
+		return ""
+	}
+
+	f := runtime.FuncForPC(v.Pointer())
+	if f == nil {
+		return ""
+	}
+	return f.Name()
+}
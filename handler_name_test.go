@@ -0,0 +1,143 @@
+package axon
+
+import (
+	"context"
+	"testing"
+
+	pb "github.com/cortexapps/axon-go/.generated/proto/github.com/cortexapps/axon"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+	"google.golang.org/grpc"
+)
+
+func syncHandler(ctx HandlerContext) error {
+	return nil
+}
+
+func genericHandler[T any](ctx HandlerContext) error {
+	return nil
+}
+
+type testSyncer struct{}
+
+func (s *testSyncer) Sync(ctx HandlerContext) error {
+	return nil
+}
+
+func (s testSyncer) Report(ctx HandlerContext) (any, error) {
+	return nil, nil
+}
+
+type otherSyncer struct{}
+
+func (s *otherSyncer) Sync(ctx HandlerContext) error {
+	return nil
+}
+
+func closureFromA() Handler {
+	return func(ctx HandlerContext) error { return nil }
+}
+
+func closureFromB() Handler {
+	return func(ctx HandlerContext) error { return nil }
+}
+
+func TestHandlerFuncName(t *testing.T) {
+	syncer := &testSyncer{}
+	closure := func(ctx HandlerContext) error { return nil }
+
+	cases := []struct {
+		name     string
+		handler  any
+		expected string
+	}{
+		{"function", syncHandler, "syncHandler"},
+		{"pointer method", syncer.Sync, "Sync-fm"},
+		{"value method", syncer.Report, "Report-fm"},
+		{"closure", closure, "func1"},
+		{"generic", genericHandler[int], "genericHandler"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			pkg, name := handlerFuncName(c.handler)
+			require.Equal(t, "github.com/cortexapps/axon-go", pkg)
+			require.Equal(t, c.expected, name)
+		})
+	}
+}
+
+func TestRegisterHandlerWithName(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+	agent, mock := createAgent(controller)
+
+	mock.agentStub.EXPECT().RegisterHandler(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, req *pb.RegisterHandlerRequest, opts ...grpc.CallOption) (*pb.RegisterHandlerResponse, error) {
+			return &pb.RegisterHandlerResponse{Id: req.HandlerName}, nil
+		}).Times(3)
+
+	id, err := agent.RegisterHandler(syncHandler, WithName("sync"))
+	require.NoError(t, err)
+	require.Equal(t, "sync", agent.registeredHandlers[id].name)
+
+	id, err = agent.RegisterHandler(syncHandler, WithNamespace("billing"))
+	require.NoError(t, err)
+	require.Equal(t, "billing.syncHandler", agent.registeredHandlers[id].name)
+
+	id, err = agent.RegisterHandler(syncHandler, WithName("sync"), WithNamespace("billing"))
+	require.NoError(t, err)
+	require.Equal(t, "billing.sync", agent.registeredHandlers[id].name)
+
+	_, err = agent.RegisterHandler(syncHandler, WithName("sync"))
+	require.ErrorContains(t, err, "already registered")
+}
+
+func TestRegisterHandlerNameCollision(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+	agent, _ := createAgent(controller)
+
+	agent.handlers = append(agent.handlers, &handlerInfo{
+		name: "syncHandler",
+		pkg:  "github.com/example/other",
+	})
+
+	_, err := agent.RegisterHandler(syncHandler)
+	require.ErrorContains(t, err, "github.com/example/other")
+	require.ErrorContains(t, err, "github.com/cortexapps/axon-go")
+	require.ErrorContains(t, err, "WithName")
+}
+
+func TestRegisterHandlerAmbiguousName(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+	agent, mock := createAgent(controller)
+
+	mock.agentStub.EXPECT().RegisterHandler(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, req *pb.RegisterHandlerRequest, opts ...grpc.CallOption) (*pb.RegisterHandlerResponse, error) {
+			return &pb.RegisterHandlerResponse{Id: req.HandlerName}, nil
+		}).Times(4)
+
+	// closures in different functions are both named func1
+	_, err := agent.RegisterHandler(closureFromA())
+	require.NoError(t, err)
+	_, err = agent.RegisterHandler(closureFromB())
+	require.EqualError(t, err, "handler func1 is derived from both github.com/cortexapps/axon-go.closureFromA.func1 "+
+		"and github.com/cortexapps/axon-go.closureFromB.func1, use WithName to give closures and method values distinct names")
+	_, err = agent.RegisterHandler(closureFromB(), WithName("closureB"))
+	require.NoError(t, err)
+
+	// as are methods of different types with the same name
+	_, err = agent.RegisterHandler((&testSyncer{}).Sync)
+	require.NoError(t, err)
+	_, err = agent.RegisterHandler((&otherSyncer{}).Sync)
+	require.ErrorContains(t, err, "handler Sync-fm is derived from both github.com/cortexapps/axon-go.(*testSyncer).Sync-fm "+
+		"and github.com/cortexapps/axon-go.(*otherSyncer).Sync-fm, use WithName")
+	_, err = agent.RegisterHandler((&otherSyncer{}).Sync, WithName("otherSync"))
+	require.NoError(t, err)
+
+	// registering the same closure twice is still just a duplicate
+	_, err = agent.RegisterHandler(closureFromA())
+	require.EqualError(t, err, "handler func1 already registered")
+}
@@ -0,0 +1,162 @@
+package axon
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// HealthConfig configures the health server started by Run
+type HealthConfig struct {
+	// Addr is the address the health server listens on, e.g. ":8081"
+	Addr string
+	// MaxMessageAge fails readiness when no dispatch message has been received for
+	// this long.  Zero disables the check, which suits agents that are idle for long
+	// periods between invocations.
+	MaxMessageAge time.Duration
+}
+
+// HealthStatus is the body served by the health endpoints
+type HealthStatus struct {
+	Ready              bool       `json:"ready"`
+	Connection         string     `json:"connection"`
+	HandlersRegistered bool       `json:"handlers_registered"`
+	LastMessage        *time.Time `json:"last_message,omitempty"`
+	Reasons            []string   `json:"reasons,omitempty"`
+}
+
+// Health returns the readiness of the agent.  The agent is ready when the dispatch
+// stream is connected, every handler registered successfully and, if configured, a
+// dispatch message was received within HealthConfig.MaxMessageAge.
+func (a *Agent) Health() HealthStatus {
+	state := a.ConnectionState()
+	status := HealthStatus{
+		Connection:         state.String(),
+		HandlersRegistered: a.handlersRegistered.Load(),
+	}
+
+	if state != ConnectionConnected {
+		status.Reasons = append(status.Reasons, "dispatch stream is "+state.String())
+	}
+	if a.gaveUp.Load() {
+		status.Reasons = append(status.Reasons, "gave up reconnecting")
+	}
+	if !status.HandlersRegistered {
+		status.Reasons = append(status.Reasons, "handler registration failed")
+	}
+
+	if last := a.lastMessage.Load(); last != 0 {
+		t := time.Unix(0, last)
+		status.LastMessage = &t
+		if a.health.MaxMessageAge > 0 && time.Since(t) > a.health.MaxMessageAge {
+			status.Reasons = append(status.Reasons, fmt.Sprintf("no dispatch message for %s", time.Since(t).Round(time.Second)))
+		}
+	}
+
+	status.Ready = len(status.Reasons) == 0
+	return status
+}
+
+// HealthHandler returns an http.Handler serving /healthz and /readyz, for mounting
+// on an existing server rather than using HealthConfig.Addr.  /healthz fails once
+// the agent has given up reconnecting, even after Run returns, until Run is called
+// again, and /readyz fails
+// while Health is not ready.
+func (a *Agent) HealthHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		status := a.Health()
+		code := http.StatusOK
+		if a.gaveUp.Load() {
+			code = http.StatusServiceUnavailable
+		}
+		writeHealth(w, code, status)
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		status := a.Health()
+		code := http.StatusOK
+		if !status.Ready {
+			code = http.StatusServiceUnavailable
+		}
+		writeHealth(w, code, status)
+	})
+	return mux
+}
+
+func writeHealth(w http.ResponseWriter, code int, status HealthStatus) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(status)
+}
+
+// startHealthServer serves the health endpoints on the configured address until
+// stopHealthServer is called.  A server kept running after Run gave up is reused.
+func (a *Agent) startHealthServer() error {
+	a.healthMu.Lock()
+	defer a.healthMu.Unlock()
+
+	if a.healthServer != nil {
+		if a.keepHealth != nil {
+			a.keepHealth()
+			a.keepHealth = nil
+		}
+		return nil
+	}
+
+	listener, err := net.Listen("tcp", a.health.Addr)
+	if err != nil {
+		return fmt.Errorf("failed to start health server: %w", err)
+	}
+
+	server := &http.Server{
+		Handler:           a.HealthHandler(),
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+	go func() {
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			a.logger.Error("health server failed", zap.Error(err))
+		}
+	}()
+	a.logger.Info("health server listening", zap.String("addr", listener.Addr().String()))
+	a.healthServer = server
+	return nil
+}
+
+// keepHealthServer leaves the health server running until Stop is called, so a
+// liveness probe sees the agent gave up, unless Run starts again first
+func (a *Agent) keepHealthServer() {
+	a.healthMu.Lock()
+	defer a.healthMu.Unlock()
+
+	if a.healthServer != nil && a.keepHealth == nil {
+		a.keepHealth = context.AfterFunc(a.stopCtx, a.stopHealthServer)
+	}
+}
+
+func (a *Agent) stopHealthServer() {
+	a.healthMu.Lock()
+	server := a.healthServer
+	a.healthServer = nil
+	if a.keepHealth != nil {
+		a.keepHealth()
+		a.keepHealth = nil
+	}
+	a.healthMu.Unlock()
+
+	if server == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	server.Shutdown(ctx)
+}
+
+func (a *Agent) messageReceived() {
+	a.lastMessage.Store(time.Now().UnixNano())
+}
@@ -0,0 +1,227 @@
+package axon
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	pb "github.com/cortexapps/axon-go/.generated/proto/github.com/cortexapps/axon"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func getHealth(t *testing.T, handler http.Handler, path string) (int, HealthStatus) {
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+
+	var status HealthStatus
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &status))
+	return rec.Code, status
+}
+
+func TestHealthHandler(t *testing.T) {
+	agent := NewAxonAgent(WithHealthServer(HealthConfig{MaxMessageAge: time.Minute}))
+	handler := agent.HealthHandler()
+
+	// not ready until connected
+	code, status := getHealth(t, handler, "/readyz")
+	require.Equal(t, http.StatusServiceUnavailable, code)
+	require.False(t, status.Ready)
+	require.Equal(t, "idle", status.Connection)
+	require.Equal(t, []string{"dispatch stream is idle"}, status.Reasons)
+
+	code, _ = getHealth(t, handler, "/healthz")
+	require.Equal(t, http.StatusOK, code)
+
+	agent.setConnectionState(ConnectionConnected)
+	agent.messageReceived()
+	code, status = getHealth(t, handler, "/readyz")
+	require.Equal(t, http.StatusOK, code)
+	require.True(t, status.Ready)
+	require.True(t, status.HandlersRegistered)
+	require.NotNil(t, status.LastMessage)
+
+	// stale dispatch stream
+	agent.lastMessage.Store(time.Now().Add(-2 * time.Minute).UnixNano())
+	code, status = getHealth(t, handler, "/readyz")
+	require.Equal(t, http.StatusServiceUnavailable, code)
+	require.Contains(t, status.Reasons[0], "no dispatch message for 2m")
+
+	// failed registration
+	agent.messageReceived()
+	agent.handlersRegistered.Store(false)
+	code, status = getHealth(t, handler, "/readyz")
+	require.Equal(t, http.StatusServiceUnavailable, code)
+	require.Equal(t, []string{"handler registration failed"}, status.Reasons)
+
+	// the process is only unhealthy once the agent has given up
+	code, _ = getHealth(t, handler, "/healthz")
+	require.Equal(t, http.StatusOK, code)
+	agent.setConnectionState(ConnectionGaveUp)
+	code, _ = getHealth(t, handler, "/healthz")
+	require.Equal(t, http.StatusServiceUnavailable, code)
+}
+
+func TestHealthFailedRegistrationRetried(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+	agent, mock := createAgent(controller)
+
+	mock.agentStub.EXPECT().RegisterHandler(gomock.Any(), gomock.Any()).Return(nil, status.Error(codes.Unavailable, "agent is down"))
+	_, err := agent.RegisterHandler(syncHandler)
+	require.Error(t, err)
+	require.False(t, agent.Health().HandlersRegistered)
+
+	// Run registers the handler again before opening the dispatch stream
+	gomock.InOrder(
+		mock.agentStub.EXPECT().RegisterHandler(gomock.Any(), gomock.Any()).Return(&pb.RegisterHandlerResponse{Id: "1"}, nil),
+		mock.agentStub.EXPECT().Dispatch(gomock.Any(), gomock.Any()).Return(workCompletedStream(), nil),
+	)
+	require.NoError(t, agent.Run(context.Background()))
+	require.True(t, agent.Health().HandlersRegistered)
+}
+
+func freeAddr(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	return listener.Addr().String()
+}
+
+func TestHealthServer(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+	agent, mock := createAgent(controller)
+	addr := freeAddr(t)
+	agent.health = HealthConfig{Addr: addr}
+
+	// a stream that stays open until Run is cancelled
+	mock.agentStub.EXPECT().Dispatch(gomock.Any(), gomock.Any()).Return(newBidiClient(), nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	runErr := make(chan error)
+	go func() {
+		runErr <- agent.Run(ctx)
+	}()
+
+	url := fmt.Sprintf("http://%s/readyz", addr)
+	require.Eventually(t, func() bool {
+		res, err := http.Get(url)
+		if err != nil {
+			return false
+		}
+		res.Body.Close()
+		return res.StatusCode == http.StatusOK
+	}, 5*time.Second, 10*time.Millisecond)
+
+	cancel()
+	require.ErrorIs(t, <-runErr, context.Canceled)
+
+	// the server is stopped when Run returns
+	_, err := http.Get(url)
+	require.Error(t, err)
+}
+
+func TestHealthServerAfterGivingUp(t *testing.T) {
+	addr := freeAddr(t)
+	agent := NewAxonAgent(
+		WithTarget(freeAddr(t)),
+		WithHealthServer(HealthConfig{Addr: addr}),
+		WithBackoff(BackoffPolicy{InitialInterval: time.Millisecond, MaxElapsedTime: 50 * time.Millisecond}),
+	)
+
+	// nothing listens on the target, so Run gives up
+	require.Error(t, agent.Run(context.Background()))
+	require.Equal(t, ConnectionIdle, agent.ConnectionState())
+
+	// the server keeps failing the liveness probe after Run returns
+	url := fmt.Sprintf("http://%s/healthz", addr)
+	res, err := http.Get(url)
+	require.NoError(t, err)
+	var status HealthStatus
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&status))
+	res.Body.Close()
+	require.Equal(t, http.StatusServiceUnavailable, res.StatusCode)
+	require.Contains(t, status.Reasons, "gave up reconnecting")
+
+	// until the agent is stopped
+	require.NoError(t, agent.Stop(context.Background()))
+	require.Eventually(t, func() bool {
+		_, err := http.Get(url)
+		return err != nil
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestHealthServerRunAgainAfterGivingUp(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+	agent, mock := createAgent(controller)
+	addr := freeAddr(t)
+	agent.health = HealthConfig{Addr: addr}
+	agent.sleepOnError = time.Millisecond
+	agent.backoff = BackoffPolicy{InitialInterval: time.Millisecond, Multiplier: 1, MaxElapsedTime: 20 * time.Millisecond}
+
+	dispatchErr := status.Error(codes.Unavailable, "agent is down")
+	down := atomic.Bool{}
+	down.Store(true)
+	mock.agentStub.EXPECT().Dispatch(gomock.Any(), gomock.Any()).AnyTimes().DoAndReturn(
+		func(context.Context, ...grpc.CallOption) (pb.AxonAgent_DispatchClient, error) {
+			if down.Load() {
+				return nil, dispatchErr
+			}
+			// a stream that stays open until Run is cancelled
+			return newBidiClient(), nil
+		})
+	require.ErrorIs(t, agent.Run(context.Background()), dispatchErr)
+
+	url := fmt.Sprintf("http://%s/healthz", addr)
+	code, err := getStatusCode(url)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusServiceUnavailable, code)
+
+	// running again reuses the server, which passes the liveness probe once more
+	down.Store(false)
+	ctx, cancel := context.WithCancel(context.Background())
+	runErr := make(chan error)
+	go func() {
+		runErr <- agent.Run(ctx)
+	}()
+	require.Eventually(t, func() bool {
+		code, err := getStatusCode(url)
+		return err == nil && code == http.StatusOK && agent.ConnectionState() == ConnectionConnected
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// and stops it when Run returns without giving up
+	cancel()
+	require.ErrorIs(t, <-runErr, context.Canceled)
+	_, err = getStatusCode(url)
+	require.Error(t, err)
+}
+
+func getStatusCode(url string) (int, error) {
+	res, err := http.Get(url)
+	if err != nil {
+		return 0, err
+	}
+	res.Body.Close()
+	return res.StatusCode, nil
+}
+
+func TestHealthServerAddressInUse(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+
+	agent := NewAxonAgent(WithHealthServer(HealthConfig{Addr: listener.Addr().String()}))
+	err = agent.Run(context.Background())
+	require.ErrorContains(t, err, "failed to start health server")
+}
@@ -0,0 +1,176 @@
+package axon
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	pb "github.com/cortexapps/axon-go/.generated/proto/github.com/cortexapps/axon"
+	"go.uber.org/zap/zapcore"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// LogLimits caps the handler logs reported with each invocation.  Fields that are
+// zero take their value from DefaultLogLimits.
+type LogLimits struct {
+	// MaxEntries is the number of log entries reported, later entries are dropped
+	MaxEntries int
+	// MaxBytes is the total size of the log messages reported, including their
+	// fields.  The entry that reaches the limit is cut short and later entries are
+	// dropped.
+	MaxBytes int
+}
+
+// DefaultLogLimits returns the limits used unless WithInvocationLogLimits is given
+func DefaultLogLimits() LogLimits {
+	return LogLimits{
+		MaxEntries: 1000,
+		MaxBytes:   256 * 1024,
+	}
+}
+
+const truncatedSuffix = " [truncated]"
+
+// fieldsEncoderConfig encodes only the fields of a log entry, which are appended
+// to its message as a JSON object
+var fieldsEncoderConfig = zapcore.EncoderConfig{
+	EncodeTime:     zapcore.ISO8601TimeEncoder,
+	EncodeDuration: zapcore.StringDurationEncoder,
+}
+
+// formatLogMessage returns the message reported for entry, followed by its fields
+// as JSON, e.g. `call failed {"status":404,"error":"not found"}`.  The fields are
+// encoded when the entry is written so later changes to the logged values are not
+// picked up.
+func formatLogMessage(entry zapcore.Entry, fields ...[]zapcore.Field) string {
+	encoder := zapcore.NewJSONEncoder(fieldsEncoderConfig)
+	for _, group := range fields {
+		for _, field := range group {
+			field.AddTo(encoder)
+		}
+	}
+
+	buf, err := encoder.EncodeEntry(zapcore.Entry{}, nil)
+	if err != nil {
+		return entry.Message
+	}
+	defer buf.Free()
+
+	encoded := strings.TrimSpace(buf.String())
+	if encoded == "{}" {
+		return entry.Message
+	}
+	if entry.Message == "" {
+		return encoded
+	}
+	return entry.Message + " " + encoded
+}
+
+// invocationLogs collects the logs written by one invocation's handler.  The handler
+// may keep logging after its invocation has timed out and been reported, so the logs
+// are frozen when they are reported and later entries are discarded.
+type invocationLogs struct {
+	mu      sync.Mutex
+	limits  LogLimits
+	entries []zapcore.Entry
+	size    int
+	dropped int
+	frozen  bool
+}
+
+func newInvocationLogs(limits LogLimits) *invocationLogs {
+	defaults := DefaultLogLimits()
+	if limits.MaxEntries <= 0 {
+		limits.MaxEntries = defaults.MaxEntries
+	}
+	if limits.MaxBytes <= 0 {
+		limits.MaxBytes = defaults.MaxBytes
+	}
+	return &invocationLogs{limits: limits}
+}
+
+// core returns a zapcore.Core writing to the logs the entries enabled by level
+func (l *invocationLogs) core(level zapcore.LevelEnabler) zapcore.Core {
+	return &logCaptureCore{LevelEnabler: level, logs: l}
+}
+
+func (l *invocationLogs) add(entry zapcore.Entry, fields ...[]zapcore.Field) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.frozen {
+		return
+	}
+	if len(l.entries) >= l.limits.MaxEntries || l.size >= l.limits.MaxBytes {
+		l.dropped++
+		return
+	}
+
+	entry.Message = formatLogMessage(entry, fields...)
+	if remaining := l.limits.MaxBytes - l.size; len(entry.Message) > remaining {
+		entry.Message = strings.ToValidUTF8(entry.Message[:remaining], "") + truncatedSuffix
+		l.size = l.limits.MaxBytes
+	} else {
+		l.size += len(entry.Message)
+	}
+	l.entries = append(l.entries, entry)
+}
+
+// freeze stops capturing and returns the logs to report, ending with a marker entry
+// if any were dropped
+func (l *invocationLogs) freeze() []*pb.Log {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.frozen = true
+	logs := make([]*pb.Log, 0, len(l.entries)+1)
+	for _, entry := range l.entries {
+		logs = append(logs, &pb.Log{
+			Level:     entry.Level.CapitalString(),
+			Message:   entry.Message,
+			Timestamp: timestamppb.New(entry.Time),
+		})
+	}
+
+	if l.dropped > 0 {
+		logs = append(logs, &pb.Log{
+			Level:     zapcore.WarnLevel.CapitalString(),
+			Message:   fmt.Sprintf("%d log entries dropped, the invocation log limit was reached", l.dropped),
+			Timestamp: timestamppb.Now(),
+		})
+	}
+	return logs
+}
+
+// logCaptureCore is the zapcore.Core handing a handler's log entries to its
+// invocationLogs, along with the fields added with Logger.With
+type logCaptureCore struct {
+	zapcore.LevelEnabler
+	logs   *invocationLogs
+	fields []zapcore.Field
+}
+
+func (c *logCaptureCore) With(fields []zapcore.Field) zapcore.Core {
+	return &logCaptureCore{
+		LevelEnabler: c.LevelEnabler,
+		logs:         c.logs,
+		fields:       append(slices.Clip(c.fields), fields...),
+	}
+}
+
+func (c *logCaptureCore) Check(entry zapcore.Entry, checked *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(entry.Level) {
+		return checked.AddCore(entry, c)
+	}
+	return checked
+}
+
+func (c *logCaptureCore) Write(entry zapcore.Entry, fields []zapcore.Field) error {
+	c.logs.add(entry, c.fields, fields)
+	return nil
+}
+
+func (c *logCaptureCore) Sync() error {
+	return nil
+}
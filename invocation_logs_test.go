@@ -0,0 +1,169 @@
+package axon
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	pb "github.com/cortexapps/axon-go/.generated/proto/github.com/cortexapps/axon"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func captureLogger(logs *invocationLogs) *zap.Logger {
+	return zap.New(logs.core(zapcore.DebugLevel))
+}
+
+func TestInvocationLogsCaptureFields(t *testing.T) {
+	logs := newInvocationLogs(DefaultLogLimits())
+	logger := captureLogger(logs).With(zap.String("entity", "my-service"))
+
+	logger.Info("calling api", zap.String("path", "/api/v1/catalog"), zap.Int("attempt", 2))
+	logger.Error("call failed", zap.Error(errors.New("boom")), zap.Duration("elapsed", 1500*time.Millisecond))
+
+	reported := logs.freeze()
+	require.Len(t, reported, 2)
+	require.Equal(t, "INFO", reported[0].Level)
+	require.Equal(t, `calling api {"entity":"my-service","path":"/api/v1/catalog","attempt":2}`, reported[0].Message)
+	require.Equal(t, "ERROR", reported[1].Level)
+	require.Equal(t, `call failed {"entity":"my-service","error":"boom","elapsed":"1.5s"}`, reported[1].Message)
+	require.NotNil(t, reported[1].Timestamp)
+}
+
+func TestInvocationLogsFieldsEncodedWhenWritten(t *testing.T) {
+	logs := newInvocationLogs(DefaultLogLimits())
+	logger := captureLogger(logs)
+
+	body := map[string]string{"tag": "before"}
+	logger.Info("", zap.Any("body", body))
+	body["tag"] = "after"
+	logger.Info("no fields")
+
+	reported := logs.freeze()
+	require.Equal(t, `{"body":{"tag":"before"}}`, reported[0].Message)
+	require.Equal(t, "no fields", reported[1].Message)
+}
+
+func TestInvocationLogsLevel(t *testing.T) {
+	logs := newInvocationLogs(DefaultLogLimits())
+	logger := zap.New(logs.core(zapcore.InfoLevel))
+
+	logger.Debug("not captured")
+	logger.Info("captured")
+
+	reported := logs.freeze()
+	require.Len(t, reported, 1)
+	require.Equal(t, "captured", reported[0].Message)
+}
+
+func TestInvocationLogsMaxEntries(t *testing.T) {
+	logs := newInvocationLogs(LogLimits{MaxEntries: 2, MaxBytes: 1024})
+	logger := captureLogger(logs)
+
+	for i := 0; i < 5; i++ {
+		logger.Info("message")
+	}
+
+	reported := logs.freeze()
+	require.Len(t, reported, 3)
+	require.Equal(t, "message", reported[1].Message)
+	require.Equal(t, "WARN", reported[2].Level)
+	require.Equal(t, "3 log entries dropped, the invocation log limit was reached", reported[2].Message)
+}
+
+func TestInvocationLogsZeroLimitsUseDefaults(t *testing.T) {
+	logs := newInvocationLogs(LogLimits{MaxEntries: 2})
+	require.Equal(t, LogLimits{MaxEntries: 2, MaxBytes: DefaultLogLimits().MaxBytes}, logs.limits)
+
+	logs = newInvocationLogs(LogLimits{})
+	require.Equal(t, DefaultLogLimits(), logs.limits)
+
+	captureLogger(logs).Info("captured")
+	reported := logs.freeze()
+	require.Len(t, reported, 1)
+	require.Equal(t, "captured", reported[0].Message)
+}
+
+func TestInvocationLogsMaxBytes(t *testing.T) {
+	logs := newInvocationLogs(LogLimits{MaxEntries: 100, MaxBytes: 10})
+	logger := captureLogger(logs)
+
+	logger.Info("123456")
+	logger.Info("789", zap.Bool("ok", true))
+	logger.Info("dropped")
+
+	reported := logs.freeze()
+	require.Len(t, reported, 3)
+	require.Equal(t, "123456", reported[0].Message)
+	require.Equal(t, "789 "+truncatedSuffix, reported[1].Message)
+	require.Equal(t, "1 log entries dropped, the invocation log limit was reached", reported[2].Message)
+}
+
+func TestInvocationLogsTruncateUTF8(t *testing.T) {
+	logs := newInvocationLogs(LogLimits{MaxEntries: 100, MaxBytes: 4})
+	captureLogger(logs).Info("abcé")
+
+	reported := logs.freeze()
+	require.Equal(t, "abc"+truncatedSuffix, reported[0].Message)
+}
+
+func TestInvocationLogsFrozen(t *testing.T) {
+	logs := newInvocationLogs(DefaultLogLimits())
+	logger := captureLogger(logs)
+
+	logger.Info("before")
+	reported := logs.freeze()
+	logger.Info("after")
+
+	require.Len(t, reported, 1)
+	require.Len(t, logs.entries, 1)
+	require.Zero(t, logs.dropped)
+}
+
+func TestInvokeHandlerLogsAfterTimeout(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+
+	theHandler := func(ctx HandlerContext) error {
+		ctx.Logger().Info("starting", zap.String("key", "value"))
+		time.Sleep(time.Millisecond * 20)
+		for i := 0; i < 100; i++ {
+			ctx.Logger().Info("still running")
+		}
+		return nil
+	}
+
+	reported := make(chan *pb.ReportInvocationRequest, 1)
+	executeHandlerHelper(t, controller, theHandler, 5, func(req *pb.ReportInvocationRequest) {
+		reported <- req
+	})
+
+	req := <-reported
+	require.Equal(t, ErrorCodeTimeout, req.GetError().GetCode())
+	require.Len(t, req.Logs, 1)
+	require.Equal(t, `starting {"key":"value"}`, req.Logs[0].Message)
+}
+
+func TestInvokeHandlerLogsPerInvocation(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+
+	theHandler := func(ctx HandlerContext) error {
+		ctx.Logger().Info(strings.Repeat("x", 3))
+		return nil
+	}
+
+	reported := make(chan *pb.ReportInvocationRequest, 1)
+	executeHandlerHelper(t, controller, theHandler, 0, func(req *pb.ReportInvocationRequest) {
+		reported <- req
+	})
+
+	// logs written by the agent itself are not reported with the invocation
+	req := <-reported
+	require.Nil(t, req.GetError())
+	require.Len(t, req.Logs, 1)
+	require.Equal(t, "xxx", req.Logs[0].Message)
+}
@@ -0,0 +1,98 @@
+package axon
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"time"
+
+	pb "github.com/cortexapps/axon-go/.generated/proto/github.com/cortexapps/axon"
+	"google.golang.org/protobuf/proto"
+)
+
+// localClient is the grpcClient of invocations run by InvokeLocal, which call the
+// Cortex API but have no agent to report to
+type localClient struct {
+	cortexApi pb.CortexApiClient
+}
+
+func (c localClient) api() pb.CortexApiClient {
+	return c.cortexApi
+}
+
+func (c localClient) agent() pb.AxonAgentClient {
+	return nil
+}
+
+// InvokeLocal runs handler, a Handler or InvocableHandler, once for invoke without
+// connecting to the agent.  The handler runs the same way as an invocation dispatched
+// by Run, with its timeout, middleware, panic recovery and log capture, and its Cortex
+// API calls are made with api.  It returns the report Run would send to the agent once
+// the handler returns or times out.  It is intended for unit testing handlers, see
+// the axontest package.
+func (a *Agent) InvokeLocal(ctx context.Context, handler any, invoke *pb.DispatchHandlerInvoke, api pb.CortexApiClient, invokeOptions ...RegisterHandlerOption) (*pb.ReportInvocationRequest, error) {
+	return a.invokeLocal(ctx, handler, handler, invoke, api, invokeOptions...)
+}
+
+// InvokeTypedLocal runs a TypedHandler once for invoke without connecting to the
+// agent, decoding its args as RegisterTypedHandler does.  See Agent.InvokeLocal.
+func InvokeTypedLocal[In any, Out any](ctx context.Context, a *Agent, handler TypedHandler[In, Out], invoke *pb.DispatchHandlerInvoke, api pb.CortexApiClient, invokeOptions ...RegisterHandlerOption) (*pb.ReportInvocationRequest, error) {
+	if err := checkArgType(reflect.TypeFor[In]()); err != nil {
+		return nil, err
+	}
+	return a.invokeLocal(ctx, handler, handler.invocable(), invoke, api, invokeOptions...)
+}
+
+// invokeLocal runs handler, naming it after fn which is the function supplied by
+// the caller
+func (a *Agent) invokeLocal(ctx context.Context, fn any, handler any, invoke *pb.DispatchHandlerInvoke, api pb.CortexApiClient, invokeOptions ...RegisterHandlerOption) (*pb.ReportInvocationRequest, error) {
+	if _, ok := asInvocableHandler(handler); !ok {
+		return nil, fmt.Errorf("unknown handler type: %T", handler)
+	}
+
+	opts := defaultRegisterHandlerOptions()
+	for _, opt := range invokeOptions {
+		opt(opts)
+	}
+
+	pkg, name, _, err := resolveHandlerName(fn, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	info := &handlerInfo{
+		dispatchId: a.DispatchId,
+		name:       name,
+		pkg:        pkg,
+		options:    opts.handlerOptions,
+		handler:    handler,
+		timeout:    opts.timeout,
+		middleware: opts.middleware,
+	}
+
+	// fill in what the agent would have set from the registration
+	invoke = proto.Clone(invoke).(*pb.DispatchHandlerInvoke)
+	if invoke.HandlerName == "" {
+		invoke.HandlerName = name
+	}
+	if invoke.DispatchId == "" {
+		invoke.DispatchId = a.DispatchId
+	}
+	if invoke.TimeoutMs == 0 {
+		invoke.TimeoutMs = int32(info.timeout.Milliseconds())
+	}
+
+	invokeCtx, span := a.startInvocationSpan(ctx, invoke)
+	invokeCtx, abort := context.WithCancel(invokeCtx)
+	defer abort()
+
+	if invoke.TimeoutMs != 0 {
+		var cancel context.CancelFunc
+		invokeCtx, cancel = context.WithTimeout(invokeCtx, time.Millisecond*time.Duration(invoke.TimeoutMs))
+		defer cancel()
+	}
+
+	inv := a.trackInvocation(localClient{cortexApi: api}, invoke, span, abort)
+	defer a.untrackInvocation(inv)
+	return a.runInvocation(invokeCtx, info, inv, func() {}), nil
+}
@@ -0,0 +1,102 @@
+package axon
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	pb "github.com/cortexapps/axon-go/.generated/proto/github.com/cortexapps/axon"
+	"github.com/cortexapps/axon-go/mock_axon"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+func TestInvokeLocal(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+
+	api := mock_axon.NewMockCortexApiClient(controller)
+	api.EXPECT().Call(gomock.Any(), gomock.Any()).Return(&pb.CallResponse{StatusCode: 200, Body: `{"ok":true}`}, nil)
+
+	handler := func(ctx HandlerContext) (any, error) {
+		res, err := ctx.CortexJsonApiCall("GET", "/api/v1/catalog", "")
+		if err != nil {
+			return nil, err
+		}
+		ctx.Logger().Info("called api")
+		return map[string]string{"body": res.Body, "arg": ctx.Args()["arg"]}, nil
+	}
+
+	agent := NewAxonAgent()
+	invoke := &pb.DispatchHandlerInvoke{Args: map[string]string{"arg": "value"}}
+	report, err := agent.InvokeLocal(context.Background(), handler, invoke, api, WithName("local"))
+	require.NoError(t, err)
+
+	require.Nil(t, report.GetError())
+	require.Equal(t, `{"arg":"value","body":"{\"ok\":true}"}`, report.GetResult().GetValue())
+	require.Equal(t, "local", report.HandlerInvoke.HandlerName)
+	require.Equal(t, agent.DispatchId, report.HandlerInvoke.DispatchId)
+	require.Len(t, report.Logs, 1)
+
+	// the caller's invoke is left as is
+	require.Empty(t, invoke.HandlerName)
+}
+
+func TestInvokeLocalTimeout(t *testing.T) {
+	handler := func(ctx HandlerContext) error {
+		time.Sleep(50 * time.Millisecond)
+		return nil
+	}
+
+	report, err := NewAxonAgent().InvokeLocal(context.Background(), handler, &pb.DispatchHandlerInvoke{}, nil, WithTimeout(5*time.Millisecond))
+	require.NoError(t, err)
+	require.Equal(t, ErrorCodeTimeout, report.GetError().GetCode())
+	require.EqualValues(t, 5, report.HandlerInvoke.TimeoutMs)
+}
+
+func TestInvokeLocalPanicAndMiddleware(t *testing.T) {
+	var calls []string
+	middleware := func(next InvocableHandler) InvocableHandler {
+		return func(ctx HandlerContext) (any, error) {
+			calls = append(calls, "middleware")
+			return next(ctx)
+		}
+	}
+
+	handler := func(ctx HandlerContext) error {
+		panic("boom")
+	}
+
+	report, err := NewAxonAgent().InvokeLocal(context.Background(), handler, &pb.DispatchHandlerInvoke{}, nil, WithMiddleware(middleware))
+	require.NoError(t, err)
+	require.Equal(t, ErrorCodeUnexpected, report.GetError().GetCode())
+	require.Contains(t, report.GetError().GetMessage(), "boom")
+	require.Equal(t, []string{"middleware"}, calls)
+}
+
+func TestInvokeTypedLocal(t *testing.T) {
+	type args struct {
+		Count int `axon:"count,required"`
+	}
+	handler := func(ctx HandlerContext, in args) (int, error) {
+		if in.Count < 0 {
+			return 0, errors.New("negative count")
+		}
+		return in.Count * 2, nil
+	}
+
+	agent := NewAxonAgent()
+	report, err := InvokeTypedLocal(context.Background(), agent, handler, &pb.DispatchHandlerInvoke{Args: map[string]string{"count": "21"}}, nil)
+	require.NoError(t, err)
+	require.Equal(t, "42", report.GetResult().GetValue())
+
+	report, err = InvokeTypedLocal(context.Background(), agent, handler, &pb.DispatchHandlerInvoke{}, nil)
+	require.NoError(t, err)
+	require.Equal(t, ErrorCodeInvalidArgs, report.GetError().GetCode())
+}
+
+func TestInvokeLocalUnknownHandler(t *testing.T) {
+	_, err := NewAxonAgent().InvokeLocal(context.Background(), func() {}, &pb.DispatchHandlerInvoke{}, nil)
+	require.ErrorContains(t, err, "unknown handler type")
+}
@@ -0,0 +1,90 @@
+package axon
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	pb "github.com/cortexapps/axon-go/.generated/proto/github.com/cortexapps/axon"
+)
+
+// validateInvokeOptions checks the invoke options a handler is registered with so
+// that unsupported values or combinations fail at registration rather than being
+// dropped by the agent
+func validateInvokeOptions(options []*pb.HandlerOption) error {
+
+	seen := map[pb.HandlerInvokeType][]string{}
+
+	for _, option := range options {
+		invoke := option.GetInvoke()
+		if invoke == nil {
+			continue
+		}
+
+		value := strings.TrimSpace(invoke.Value)
+
+		switch invoke.Type {
+		case pb.HandlerInvokeType_INVOKE, pb.HandlerInvokeType_RUN_NOW:
+			if value != "" {
+				return fmt.Errorf("%s does not take a value, got %q", invoke.Type, invoke.Value)
+			}
+			if len(seen[invoke.Type]) > 0 {
+				return fmt.Errorf("%s specified more than once", invoke.Type)
+			}
+		case pb.HandlerInvokeType_RUN_INTERVAL:
+			interval, err := time.ParseDuration(value)
+			if err != nil {
+				return fmt.Errorf("invalid %s value %q: %w", invoke.Type, invoke.Value, err)
+			}
+			if interval <= 0 {
+				return fmt.Errorf("%s must be positive, got %q", invoke.Type, invoke.Value)
+			}
+			if len(seen[invoke.Type]) > 0 {
+				return fmt.Errorf("%s specified more than once", invoke.Type)
+			}
+		case pb.HandlerInvokeType_CRON_SCHEDULE:
+			if err := validateCronSchedule(value); err != nil {
+				return fmt.Errorf("invalid %s value %q: %w", invoke.Type, invoke.Value, err)
+			}
+		case pb.HandlerInvokeType_WEBHOOK:
+			if value == "" {
+				return fmt.Errorf("%s requires a webhook id", invoke.Type)
+			}
+		default:
+			return fmt.Errorf("unsupported invoke type %s", invoke.Type)
+		}
+
+		for _, existing := range seen[invoke.Type] {
+			if existing == value {
+				return fmt.Errorf("%s %q specified more than once", invoke.Type, invoke.Value)
+			}
+		}
+		seen[invoke.Type] = append(seen[invoke.Type], value)
+	}
+	return nil
+}
+
+// validateCronSchedule checks the shape of a cron schedule, leaving the full
+// validation to the agent.  Descriptors such as @hourly are passed through, apart
+// from checking the duration of @every.
+func validateCronSchedule(schedule string) error {
+	if every, ok := strings.CutPrefix(schedule, "@every "); ok {
+		interval, err := time.ParseDuration(strings.TrimSpace(every))
+		if err != nil {
+			return err
+		}
+		if interval <= 0 {
+			return fmt.Errorf("@every must be positive, got %s", every)
+		}
+		return nil
+	}
+	if strings.HasPrefix(schedule, "@") {
+		return nil
+	}
+
+	fields := strings.Fields(schedule)
+	if len(fields) != 5 && len(fields) != 6 {
+		return fmt.Errorf("expected 5 or 6 fields, got %d", len(fields))
+	}
+	return nil
+}
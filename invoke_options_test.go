@@ -0,0 +1,95 @@
+package axon
+
+import (
+	"context"
+	"testing"
+
+	pb "github.com/cortexapps/axon-go/.generated/proto/github.com/cortexapps/axon"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+	"google.golang.org/grpc"
+)
+
+func TestValidateInvokeOptions(t *testing.T) {
+
+	cases := []struct {
+		name    string
+		options []RegisterHandlerOption
+		err     string
+	}{
+		{"all triggers", []RegisterHandlerOption{
+			WithInvokeOption(pb.HandlerInvokeType_INVOKE, ""),
+			WithInvokeOption(pb.HandlerInvokeType_RUN_NOW, ""),
+			WithInvokeOption(pb.HandlerInvokeType_RUN_INTERVAL, "10s"),
+			WithInvokeOption(pb.HandlerInvokeType_CRON_SCHEDULE, "*/5 * * * *"),
+			WithInvokeOption(pb.HandlerInvokeType_CRON_SCHEDULE, "@hourly"),
+			WithInvokeOption(pb.HandlerInvokeType_CRON_SCHEDULE, "@every 5m"),
+			WithInvokeOption(pb.HandlerInvokeType_CRON_SCHEDULE, "@reboot"),
+			WithInvokeOption(pb.HandlerInvokeType_WEBHOOK, "hook-1"),
+			WithInvokeOption(pb.HandlerInvokeType_WEBHOOK, "hook-2"),
+		}, ""},
+		{"bad interval", []RegisterHandlerOption{WithInvokeOption(pb.HandlerInvokeType_RUN_INTERVAL, "soon")}, "invalid RUN_INTERVAL"},
+		{"negative interval", []RegisterHandlerOption{WithInvokeOption(pb.HandlerInvokeType_RUN_INTERVAL, "-1s")}, "must be positive"},
+		{"two intervals", []RegisterHandlerOption{
+			WithInvokeOption(pb.HandlerInvokeType_RUN_INTERVAL, "1s"),
+			WithInvokeOption(pb.HandlerInvokeType_RUN_INTERVAL, "2s"),
+		}, "more than once"},
+		{"bad cron", []RegisterHandlerOption{WithInvokeOption(pb.HandlerInvokeType_CRON_SCHEDULE, "* *")}, "expected 5 or 6 fields"},
+		{"bad every", []RegisterHandlerOption{WithInvokeOption(pb.HandlerInvokeType_CRON_SCHEDULE, "@every soon")}, `invalid CRON_SCHEDULE value "@every soon"`},
+		{"negative every", []RegisterHandlerOption{WithInvokeOption(pb.HandlerInvokeType_CRON_SCHEDULE, "@every -5m")}, "must be positive"},
+		{"webhook without id", []RegisterHandlerOption{WithInvokeOption(pb.HandlerInvokeType_WEBHOOK, "")}, "requires a webhook id"},
+		{"duplicate webhook", []RegisterHandlerOption{
+			WithInvokeOption(pb.HandlerInvokeType_WEBHOOK, "hook"),
+			WithInvokeOption(pb.HandlerInvokeType_WEBHOOK, "hook"),
+		}, "more than once"},
+		{"run now with value", []RegisterHandlerOption{WithInvokeOption(pb.HandlerInvokeType_RUN_NOW, "1s")}, "does not take a value"},
+		{"unknown type", []RegisterHandlerOption{WithInvokeOption(pb.HandlerInvokeType(42), "")}, "unsupported invoke type"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			opts := &registerHandlerOptions{}
+			for _, opt := range c.options {
+				opt(opts)
+			}
+			err := validateInvokeOptions(opts.handlerOptions)
+			if c.err == "" {
+				require.NoError(t, err)
+			} else {
+				require.ErrorContains(t, err, c.err)
+			}
+		})
+	}
+}
+
+func TestRegisterInvocableHandlerWithOptions(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+	agent, mock := createAgent(controller)
+
+	theHandler := func(ctx HandlerContext) (any, error) {
+		return "ok", nil
+	}
+
+	mock.agentStub.EXPECT().RegisterHandler(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, req *pb.RegisterHandlerRequest, opts ...grpc.CallOption) (*pb.RegisterHandlerResponse, error) {
+			require.Len(t, req.Options, 2)
+			require.Equal(t, pb.HandlerInvokeType_WEBHOOK, req.Options[0].GetInvoke().Type)
+			require.Equal(t, "my-webhook", req.Options[0].GetInvoke().Value)
+			require.Equal(t, pb.HandlerInvokeType_RUN_INTERVAL, req.Options[1].GetInvoke().Type)
+			return &pb.RegisterHandlerResponse{Id: "invocable"}, nil
+		})
+
+	id, err := agent.RegisterInvocableHandler(theHandler,
+		WithInvokeOption(pb.HandlerInvokeType_WEBHOOK, "my-webhook"),
+		WithInvokeOption(pb.HandlerInvokeType_RUN_INTERVAL, "1m"),
+	)
+	require.NoError(t, err)
+	require.Len(t, agent.registeredHandlers[id].options, 2)
+
+	_, err = agent.RegisterInvocableHandler(theHandler,
+		WithName("other"),
+		WithInvokeOption(pb.HandlerInvokeType_RUN_INTERVAL, "often"),
+	)
+	require.ErrorContains(t, err, "invalid options for handler other")
+}
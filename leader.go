@@ -0,0 +1,115 @@
+package axon
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	pb "github.com/cortexapps/axon-go/.generated/proto/github.com/cortexapps/axon"
+	"go.uber.org/zap"
+)
+
+// DefaultLeaseDuration is the leader lease used when WithLeaderElection is given a
+// lease that is not positive
+const DefaultLeaseDuration = 30 * time.Second
+
+// leaderElection elects one replica to run scheduled handlers
+type leaderElection struct {
+	locker        Locker
+	leaseDuration time.Duration
+	leader        atomic.Bool
+	// unsynced is set while the scheduled handlers' registrations don't match the
+	// leadership, until updating them succeeds
+	unsynced atomic.Bool
+}
+
+// IsLeader returns true if this replica runs scheduled handlers.  It is always
+// true when leader election is not enabled.
+func (a *Agent) IsLeader() bool {
+	return a.leaderElection == nil || a.leaderElection.leader.Load()
+}
+
+// isScheduledOption returns true for invoke options fired by the agent on a schedule,
+// which only the leader registers
+func isScheduledOption(option *pb.HandlerOption) bool {
+	switch option.GetInvoke().GetType() {
+	case pb.HandlerInvokeType_RUN_INTERVAL, pb.HandlerInvokeType_CRON_SCHEDULE:
+		return true
+	}
+	return false
+}
+
+func isScheduledHandler(info *handlerInfo) bool {
+	for _, option := range info.options {
+		if isScheduledOption(option) {
+			return true
+		}
+	}
+	return false
+}
+
+// registrationOptions returns the options to register the handler with.  Replicas
+// that are not the leader leave out the schedule, along with RUN_NOW which belongs
+// to it, and skip the registration when nothing else is left.
+func (a *Agent) registrationOptions(info *handlerInfo) ([]*pb.HandlerOption, bool) {
+	if a.IsLeader() || !isScheduledHandler(info) {
+		return info.options, true
+	}
+
+	options := withoutSchedule(info.options)
+	return options, len(options) > 0
+}
+
+// runLeaderElection renews or acquires the leader lease until ctx ends, then
+// releases it so another replica can take over straight away
+func (a *Agent) runLeaderElection(ctx context.Context) {
+	election := a.leaderElection
+	defer func() {
+		if err := election.locker.Unlock(context.Background(), a.DispatchId); err != nil {
+			a.logger.Warn("failed to release leader lease", zap.Error(err))
+		}
+		election.leader.Store(false)
+	}()
+
+	// renew well within the lease so a slow renewal does not lose it
+	interval := election.leaseDuration / 3
+	for sleep(ctx, interval) {
+		a.electLeader(ctx)
+	}
+}
+
+// electLeader tries to acquire the leader lease, registering or unregistering the
+// scheduled handlers when leadership changes.  A failed update is retried on every
+// later call until it succeeds.
+func (a *Agent) electLeader(ctx context.Context) {
+	election := a.leaderElection
+	leader, err := election.locker.TryLock(ctx, a.DispatchId, election.leaseDuration)
+	if err != nil {
+		if ctx.Err() != nil {
+			return
+		}
+		// without a renewed lease another replica may take over, so step down
+		// rather than risk both running the schedule
+		a.logger.Warn("failed to renew leader lease", zap.Error(err))
+		leader = false
+	}
+
+	if election.leader.Swap(leader) != leader {
+		if leader {
+			a.logger.Info("elected leader, registering scheduled handlers")
+		} else {
+			a.logger.Info("lost leadership, unregistering scheduled handlers")
+		}
+		election.unsynced.Store(true)
+	}
+	if !election.unsynced.Load() {
+		return
+	}
+
+	if err := a.reregisterMatchingHandlers(ctx, isScheduledHandler); err != nil {
+		a.logger.Error("failed to update scheduled handlers, retrying", zap.Error(err))
+		a.handlersRegistered.Store(false)
+		return
+	}
+	election.unsynced.Store(false)
+}
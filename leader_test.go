@@ -0,0 +1,285 @@
+package axon
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	pb "github.com/cortexapps/axon-go/.generated/proto/github.com/cortexapps/axon"
+	"github.com/cortexapps/axon-go/mock_axon"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func invokeTypes(options []*pb.HandlerOption) []pb.HandlerInvokeType {
+	var types []pb.HandlerInvokeType
+	for _, option := range options {
+		types = append(types, option.GetInvoke().GetType())
+	}
+	return types
+}
+
+func TestRegistrationOptions(t *testing.T) {
+	agent := NewAxonAgent(WithLeaderElection(NewMemoryLocker(), time.Minute))
+
+	opts := defaultRegisterHandlerOptions()
+	for _, opt := range []RegisterHandlerOption{
+		WithInvokeOption(pb.HandlerInvokeType_RUN_NOW, ""),
+		WithInvokeOption(pb.HandlerInvokeType_RUN_INTERVAL, "1m"),
+		WithInvokeOption(pb.HandlerInvokeType_WEBHOOK, "hook"),
+	} {
+		opt(opts)
+	}
+	mixed := &handlerInfo{options: opts.handlerOptions}
+	scheduled := &handlerInfo{options: opts.handlerOptions[:2]}
+	plain := &handlerInfo{}
+
+	// followers leave out the schedule
+	require.False(t, agent.IsLeader())
+	options, ok := agent.registrationOptions(mixed)
+	require.True(t, ok)
+	require.Equal(t, []pb.HandlerInvokeType{pb.HandlerInvokeType_WEBHOOK}, invokeTypes(options))
+
+	_, ok = agent.registrationOptions(scheduled)
+	require.False(t, ok)
+
+	_, ok = agent.registrationOptions(plain)
+	require.True(t, ok)
+
+	// while the leader registers everything
+	agent.leaderElection.leader.Store(true)
+	options, ok = agent.registrationOptions(mixed)
+	require.True(t, ok)
+	require.Len(t, options, 3)
+
+	options, ok = agent.registrationOptions(scheduled)
+	require.True(t, ok)
+	require.Len(t, options, 2)
+}
+
+type leaderTestReplica struct {
+	agent         *Agent
+	mock          *mockGrpcClient
+	registrations chan []pb.HandlerInvokeType
+}
+
+func newLeaderTestReplica(t *testing.T, controller *gomock.Controller, locker Locker) *leaderTestReplica {
+	r := &leaderTestReplica{
+		agent: NewAxonAgent(WithSleepOnError(0), WithLeaderElection(locker, time.Minute)),
+		mock: &mockGrpcClient{
+			apiStub:   mock_axon.NewMockCortexApiClient(controller),
+			agentStub: mock_axon.NewMockAxonAgentClient(controller),
+		},
+		registrations: make(chan []pb.HandlerInvokeType, 10),
+	}
+	r.agent.client = r.mock
+
+	ids := 0
+	r.mock.agentStub.EXPECT().RegisterHandler(gomock.Any(), gomock.Any()).AnyTimes().DoAndReturn(
+		func(ctx context.Context, req *pb.RegisterHandlerRequest, opts ...grpc.CallOption) (*pb.RegisterHandlerResponse, error) {
+			ids++
+			r.registrations <- invokeTypes(req.Options)
+			return &pb.RegisterHandlerResponse{Id: fmt.Sprintf("%s-%d", req.HandlerName, ids)}, nil
+		})
+	r.mock.agentStub.EXPECT().UnregisterHandler(gomock.Any(), gomock.Any()).AnyTimes().Return(&pb.UnregisterHandlerResponse{}, nil)
+
+	_, err := r.agent.RegisterHandler(syncHandler,
+		WithInvokeOption(pb.HandlerInvokeType_CRON_SCHEDULE, "* * * * *"),
+		WithInvokeOption(pb.HandlerInvokeType_INVOKE, ""),
+	)
+	require.NoError(t, err)
+	_, err = r.agent.RegisterHandler(func(HandlerContext) error { return nil },
+		WithName("webhook"),
+		WithInvokeOption(pb.HandlerInvokeType_WEBHOOK, "hook"),
+	)
+	require.NoError(t, err)
+
+	// before the election every replica is a follower
+	require.Equal(t, []pb.HandlerInvokeType{pb.HandlerInvokeType_INVOKE}, <-r.registrations)
+	require.Equal(t, []pb.HandlerInvokeType{pb.HandlerInvokeType_WEBHOOK}, <-r.registrations)
+	return r
+}
+
+func TestLeaderElectionHandover(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+
+	clock := &fakeClock{now: time.Now()}
+	locker := NewMemoryLocker().(*memoryLocker)
+	locker.now = clock.Now
+
+	first := newLeaderTestReplica(t, controller, locker)
+	second := newLeaderTestReplica(t, controller, locker)
+	ctx := context.Background()
+
+	// the first replica is elected and registers the schedule, only reregistering
+	// the scheduled handler
+	first.agent.electLeader(ctx)
+	require.True(t, first.agent.IsLeader())
+	require.Equal(t, []pb.HandlerInvokeType{pb.HandlerInvokeType_CRON_SCHEDULE, pb.HandlerInvokeType_INVOKE}, <-first.registrations)
+	require.Empty(t, first.registrations)
+
+	second.agent.electLeader(ctx)
+	require.False(t, second.agent.IsLeader())
+	require.Empty(t, second.registrations)
+
+	// when the leader stops renewing, the lease expires and the second replica takes over
+	clock.now = clock.now.Add(2 * time.Minute)
+	second.agent.electLeader(ctx)
+	require.True(t, second.agent.IsLeader())
+	require.Equal(t, []pb.HandlerInvokeType{pb.HandlerInvokeType_CRON_SCHEDULE, pb.HandlerInvokeType_INVOKE}, <-second.registrations)
+
+	first.agent.electLeader(ctx)
+	require.False(t, first.agent.IsLeader())
+	require.Equal(t, []pb.HandlerInvokeType{pb.HandlerInvokeType_INVOKE}, <-first.registrations)
+	require.Len(t, first.agent.registeredHandlers, 2)
+}
+
+func TestLeaderElectionReleasedWhenRunExits(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+
+	locker := NewMemoryLocker()
+	replica := newLeaderTestReplica(t, controller, locker)
+	replica.mock.agentStub.EXPECT().Dispatch(gomock.Any(), gomock.Any()).Return(workCompletedStream(), nil)
+
+	require.NoError(t, replica.agent.Run(context.Background()))
+	require.Equal(t, []pb.HandlerInvokeType{pb.HandlerInvokeType_CRON_SCHEDULE, pb.HandlerInvokeType_INVOKE}, <-replica.registrations)
+	require.False(t, replica.agent.IsLeader())
+
+	// the lease is free for another replica straight away
+	ok, err := locker.TryLock(context.Background(), "other", time.Minute)
+	require.NoError(t, err)
+	require.True(t, ok)
+}
+
+func TestScheduledHandlerIdBeforeElection(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+
+	replica := newLeaderTestReplica(t, controller, NewMemoryLocker())
+	agent := replica.agent
+
+	// a follower doesn't register a handler that only has a schedule, it still
+	// gets an id that refers to the registrations made once it is elected
+	id, err := agent.RegisterHandler(syncHandler, WithName("interval"),
+		WithInvokeOption(pb.HandlerInvokeType_RUN_INTERVAL, "1m"),
+	)
+	require.NoError(t, err)
+	require.NotEmpty(t, id)
+	require.Empty(t, replica.registrations)
+
+	agent.electLeader(context.Background())
+	require.True(t, agent.IsLeader())
+	require.Equal(t, []pb.HandlerInvokeType{pb.HandlerInvokeType_CRON_SCHEDULE, pb.HandlerInvokeType_INVOKE}, <-replica.registrations)
+	require.Equal(t, []pb.HandlerInvokeType{pb.HandlerInvokeType_RUN_INTERVAL}, <-replica.registrations)
+	require.Len(t, agent.registeredHandlers, 3)
+
+	// unregistering by the id removes the registration and the handler, so it
+	// is not registered again on the next change of leader
+	require.NoError(t, agent.UnregisterHandler(id))
+	require.Len(t, agent.registeredHandlers, 2)
+	require.Len(t, agent.handlers, 2)
+	for _, h := range agent.registeredHandlers {
+		require.NotEqual(t, "interval", h.name)
+	}
+}
+
+func TestLeaderChangeUpdatesEveryEndpoint(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+
+	clock := &fakeClock{now: time.Now()}
+	locker := NewMemoryLocker().(*memoryLocker)
+	locker.now = clock.Now
+
+	agent, mocks := createMultiEndpointAgent(controller, EndpointRegisterAll, WithLeaderElection(locker, time.Minute))
+	connected := func() bool { return true }
+	first := serveFakeEndpoint(mocks[0], "a", connected)
+	second := serveFakeEndpoint(mocks[1], "b", connected)
+
+	_, err := agent.RegisterHandler(syncHandler,
+		WithInvokeOption(pb.HandlerInvokeType_RUN_INTERVAL, "1m"),
+		WithInvokeOption(pb.HandlerInvokeType_INVOKE, ""),
+	)
+	require.NoError(t, err)
+	require.Equal(t, 0, firedPerTick(first, second))
+	require.Len(t, first.registrations, 1)
+	require.Len(t, second.registrations, 1)
+
+	// the leader's schedule is only registered with the active endpoint
+	ctx := context.Background()
+	agent.electLeader(ctx)
+	require.True(t, agent.IsLeader())
+	require.Equal(t, 1, firedPerTick(first, second))
+	require.Len(t, second.registrations, 1)
+
+	// and removed from every endpoint when leadership moves to another replica,
+	// which keeps the handler registered without it
+	clock.now = clock.now.Add(2 * time.Minute)
+	ok, err := locker.TryLock(ctx, "other", time.Minute)
+	require.NoError(t, err)
+	require.True(t, ok)
+	agent.electLeader(ctx)
+	require.False(t, agent.IsLeader())
+	require.Equal(t, 0, firedPerTick(first, second))
+	require.Len(t, first.registrations, 1)
+	require.Len(t, second.registrations, 1)
+}
+
+func TestLeaderElectionRetriesFailedUpdate(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+
+	clock := &fakeClock{now: time.Now()}
+	locker := NewMemoryLocker().(*memoryLocker)
+	locker.now = clock.Now
+
+	agent, mock := createAgent(controller)
+	agent.leaderElection = &leaderElection{locker: locker, leaseDuration: time.Minute}
+	ctx := context.Background()
+
+	_, err := agent.RegisterHandler(syncHandler, WithInvokeOption(pb.HandlerInvokeType_RUN_INTERVAL, "1m"))
+	require.NoError(t, err)
+
+	unavailable := status.Error(codes.Unavailable, "agent is down")
+	gomock.InOrder(
+		mock.agentStub.EXPECT().RegisterHandler(gomock.Any(), gomock.Any()).Return(nil, unavailable),
+		mock.agentStub.EXPECT().RegisterHandler(gomock.Any(), gomock.Any()).Return(&pb.RegisterHandlerResponse{Id: "1"}, nil),
+		mock.agentStub.EXPECT().UnregisterHandler(gomock.Any(), &pb.UnregisterHandlerRequest{Id: "1"}).Return(nil, unavailable),
+		mock.agentStub.EXPECT().UnregisterHandler(gomock.Any(), &pb.UnregisterHandlerRequest{Id: "1"}).Return(&pb.UnregisterHandlerResponse{}, nil),
+	)
+
+	// registering the schedule fails when elected, and is retried on the next tick
+	agent.electLeader(ctx)
+	require.True(t, agent.IsLeader())
+	require.Empty(t, agent.registeredHandlers)
+	agent.electLeader(ctx)
+	require.Len(t, agent.registeredHandlers, 1)
+	agent.electLeader(ctx)
+
+	// as is removing it once another replica takes over
+	clock.now = clock.now.Add(2 * time.Minute)
+	ok, err := locker.TryLock(ctx, "other", time.Minute)
+	require.NoError(t, err)
+	require.True(t, ok)
+	agent.electLeader(ctx)
+	require.False(t, agent.IsLeader())
+	require.Len(t, agent.staleRegistrations, 1)
+	agent.electLeader(ctx)
+	require.Empty(t, agent.staleRegistrations)
+	require.Empty(t, agent.registeredHandlers)
+	agent.electLeader(ctx)
+}
+
+func TestLeaderElectionDefaultLease(t *testing.T) {
+	agent := NewAxonAgent(WithLeaderElection(NewMemoryLocker(), 0))
+	require.Equal(t, DefaultLeaseDuration, agent.leaderElection.leaseDuration)
+
+	agent = NewAxonAgent(WithLeaderElection(NewMemoryLocker(), -time.Second))
+	require.Equal(t, DefaultLeaseDuration, agent.leaderElection.leaseDuration)
+}
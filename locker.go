@@ -0,0 +1,180 @@
+package axon
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Locker is a lock backend for leader election.  The lock is a lease held by one
+// replica at a time, which expires unless the holder renews it.
+type Locker interface {
+	// TryLock acquires the lease for id, or renews it if id already holds it, so
+	// that it expires after ttl.  It returns false if another holder has a lease
+	// that has not expired.
+	TryLock(ctx context.Context, id string, ttl time.Duration) (bool, error)
+	// Unlock releases the lease if it is held by id
+	Unlock(ctx context.Context, id string) error
+}
+
+// lease is the state of a Locker's lock
+type lease struct {
+	Holder  string    `json:"holder"`
+	Expires time.Time `json:"expires"`
+}
+
+// claim returns the lease after id tries to take it at now, and whether id holds it
+func (l lease) claim(id string, now time.Time, ttl time.Duration) (lease, bool) {
+	if l.Holder != "" && l.Holder != id && now.Before(l.Expires) {
+		return l, false
+	}
+	return lease{Holder: id, Expires: now.Add(ttl)}, true
+}
+
+// NewMemoryLocker returns a Locker held in memory, which elects a leader among
+// agents in the same process.  It is intended for tests.
+func NewMemoryLocker() Locker {
+	return &memoryLocker{now: time.Now}
+}
+
+type memoryLocker struct {
+	mu    sync.Mutex
+	lease lease
+	now   func() time.Time
+}
+
+func (l *memoryLocker) TryLock(ctx context.Context, id string, ttl time.Duration) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	next, ok := l.lease.claim(id, l.now(), ttl)
+	l.lease = next
+	return ok, nil
+}
+
+func (l *memoryLocker) Unlock(ctx context.Context, id string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.lease.Holder == id {
+		l.lease = lease{}
+	}
+	return nil
+}
+
+const (
+	fileLockRetry = 10 * time.Millisecond
+	fileLockStale = 10 * time.Second
+)
+
+// NewFileLocker returns a Locker that keeps the lease in the file at path, which
+// must be on a filesystem shared by every replica, such as a shared volume.  Lease
+// expiry uses each replica's clock, so clocks should be kept in sync.
+func NewFileLocker(path string) Locker {
+	return &fileLocker{path: path, now: time.Now}
+}
+
+type fileLocker struct {
+	path string
+	now  func() time.Time
+}
+
+func (l *fileLocker) TryLock(ctx context.Context, id string, ttl time.Duration) (bool, error) {
+	held := false
+	err := l.update(ctx, func(current lease) (lease, error) {
+		next, ok := current.claim(id, l.now(), ttl)
+		held = ok
+		return next, nil
+	})
+	if err != nil {
+		return false, err
+	}
+	return held, nil
+}
+
+func (l *fileLocker) Unlock(ctx context.Context, id string) error {
+	return l.update(ctx, func(current lease) (lease, error) {
+		if current.Holder != id {
+			return current, nil
+		}
+		return lease{}, nil
+	})
+}
+
+// update reads the lease and writes the result of fn, holding a guard file so that
+// replicas do not interleave their updates
+func (l *fileLocker) update(ctx context.Context, fn func(lease) (lease, error)) error {
+	release, err := l.guard(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	var current lease
+	data, err := os.ReadFile(l.path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+	case err != nil:
+		return err
+	case len(data) > 0:
+		if err := json.Unmarshal(data, &current); err != nil {
+			return fmt.Errorf("invalid lease file %s: %w", l.path, err)
+		}
+	}
+
+	next, err := fn(current)
+	if err != nil || next == current {
+		return err
+	}
+
+	data, err = json.Marshal(next)
+	if err != nil {
+		return err
+	}
+
+	// write then rename so a crash never leaves a partially written lease
+	tmp, err := os.CreateTemp(filepath.Dir(l.path), filepath.Base(l.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), l.path)
+}
+
+// guard creates the guard file, waiting while another replica holds it.  A guard
+// left behind by a replica that crashed while updating is removed once it is stale.
+func (l *fileLocker) guard(ctx context.Context) (func(), error) {
+	guardPath := l.path + ".guard"
+	for {
+		f, err := os.OpenFile(guardPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if err == nil {
+			f.Close()
+			return func() { os.Remove(guardPath) }, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, err
+		}
+
+		if info, err := os.Stat(guardPath); err == nil && l.now().Sub(info.ModTime()) > fileLockStale {
+			os.Remove(guardPath)
+			continue
+		}
+
+		if !sleep(ctx, fileLockRetry) {
+			return nil, ctx.Err()
+		}
+	}
+}
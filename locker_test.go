@@ -0,0 +1,122 @@
+package axon
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func testLocker(t *testing.T, locker Locker, clock *fakeClock) {
+	ctx := context.Background()
+	ttl := 10 * time.Second
+
+	ok, err := locker.TryLock(ctx, "a", ttl)
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	ok, err = locker.TryLock(ctx, "b", ttl)
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	// the holder can renew before the lease expires
+	clock.now = clock.now.Add(9 * time.Second)
+	ok, err = locker.TryLock(ctx, "a", ttl)
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	clock.now = clock.now.Add(9 * time.Second)
+	ok, err = locker.TryLock(ctx, "b", ttl)
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	// once it expires another holder takes over
+	clock.now = clock.now.Add(2 * time.Second)
+	ok, err = locker.TryLock(ctx, "b", ttl)
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	ok, err = locker.TryLock(ctx, "a", ttl)
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	// only the holder can unlock
+	require.NoError(t, locker.Unlock(ctx, "a"))
+	ok, err = locker.TryLock(ctx, "a", ttl)
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	require.NoError(t, locker.Unlock(ctx, "b"))
+	ok, err = locker.TryLock(ctx, "a", ttl)
+	require.NoError(t, err)
+	require.True(t, ok)
+}
+
+func TestMemoryLocker(t *testing.T) {
+	clock := &fakeClock{now: time.Now()}
+	locker := NewMemoryLocker().(*memoryLocker)
+	locker.now = clock.Now
+	testLocker(t, locker, clock)
+}
+
+func TestFileLocker(t *testing.T) {
+	clock := &fakeClock{now: time.Now()}
+	locker := NewFileLocker(filepath.Join(t.TempDir(), "leader.lease")).(*fileLocker)
+	locker.now = clock.Now
+	testLocker(t, locker, clock)
+}
+
+func TestFileLockerSharedFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "leader.lease")
+	first := NewFileLocker(path)
+	second := NewFileLocker(path)
+
+	ok, err := first.TryLock(context.Background(), "a", time.Minute)
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	ok, err = second.TryLock(context.Background(), "b", time.Minute)
+	require.NoError(t, err)
+	require.False(t, ok)
+}
+
+func TestFileLockerInvalidLease(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "leader.lease")
+	require.NoError(t, os.WriteFile(path, []byte("not json"), 0644))
+
+	_, err := NewFileLocker(path).TryLock(context.Background(), "a", time.Minute)
+	require.ErrorContains(t, err, "invalid lease file")
+}
+
+func TestFileLockerGuard(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "leader.lease")
+	guardPath := path + ".guard"
+	require.NoError(t, os.WriteFile(guardPath, nil, 0644))
+
+	// a held guard blocks the update
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := NewFileLocker(path).TryLock(ctx, "a", time.Minute)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+
+	// until it is stale, when it is assumed to be left by a crashed replica
+	stale := time.Now().Add(-2 * fileLockStale)
+	require.NoError(t, os.Chtimes(guardPath, stale, stale))
+	ok, err := NewFileLocker(path).TryLock(context.Background(), "a", time.Minute)
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	_, err = os.Stat(guardPath)
+	require.ErrorIs(t, err, os.ErrNotExist)
+}
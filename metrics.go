@@ -0,0 +1,74 @@
+package axon
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	pb "github.com/cortexapps/axon-go/.generated/proto/github.com/cortexapps/axon"
+)
+
+// Metrics records measurements of handler invocations and the connection to the
+// agent.  Implement it to send measurements to a metrics backend, the axonprom
+// package provides a Prometheus implementation.  Methods are called concurrently
+// and should not block.
+type Metrics interface {
+	// InvocationStarted is called when a handler starts running
+	InvocationStarted(handler string, reason pb.HandlerInvokeType)
+	// InvocationFinished is called when a started invocation is reported.  An
+	// invocation that times out is reported straight away, so its handler may
+	// still be running.
+	InvocationFinished(outcome InvocationOutcome)
+	// InvocationNotRun is called when an invocation is reported without running,
+	// e.g. rejected by a full queue or skipped by a singleton handler
+	InvocationNotRun(handler string, reason pb.HandlerInvokeType, code string)
+	// ReconnectAttempted is called each time the agent retries connecting after an error
+	ReconnectAttempted()
+	// ConnectionStateChanged is called when the connection state changes
+	ConnectionStateChanged(from ConnectionState, to ConnectionState)
+}
+
+// InvocationOutcome describes a finished invocation
+type InvocationOutcome struct {
+	Handler  string
+	Reason   pb.HandlerInvokeType
+	Duration time.Duration
+	// ErrorCode is empty if the invocation succeeded
+	ErrorCode string
+	// Panicked is true if the handler panicked
+	Panicked bool
+}
+
+type nopMetrics struct{}
+
+func (nopMetrics) InvocationStarted(string, pb.HandlerInvokeType)          {}
+func (nopMetrics) InvocationFinished(InvocationOutcome)                    {}
+func (nopMetrics) InvocationNotRun(string, pb.HandlerInvokeType, string)   {}
+func (nopMetrics) ReconnectAttempted()                                     {}
+func (nopMetrics) ConnectionStateChanged(ConnectionState, ConnectionState) {}
+
+// panicError is returned for a handler that panicked
+type panicError struct {
+	value any
+}
+
+func (e *panicError) Error() string {
+	return fmt.Sprintf("panic in handler: %v", e.value)
+}
+
+func isPanic(err error) bool {
+	var p *panicError
+	return errors.As(err, &p)
+}
+
+// finishInvocation records the outcome of a started invocation once it is reported
+func (a *Agent) finishInvocation(inv *invocation, report *pb.ReportInvocationRequest, panicked bool) {
+	endInvocationSpan(inv.span, report)
+	a.metrics.InvocationFinished(InvocationOutcome{
+		Handler:   inv.invoke.HandlerName,
+		Reason:    inv.invoke.Reason,
+		Duration:  time.Since(inv.start),
+		ErrorCode: report.GetError().GetCode(),
+		Panicked:  panicked,
+	})
+}
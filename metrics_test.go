@@ -0,0 +1,194 @@
+package axon
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	pb "github.com/cortexapps/axon-go/.generated/proto/github.com/cortexapps/axon"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/trace/noop"
+	"go.uber.org/mock/gomock"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type recordingMetrics struct {
+	mu         sync.Mutex
+	started    []string
+	finished   []InvocationOutcome
+	notRun     []string
+	reconnects int
+	states     []ConnectionState
+}
+
+func (m *recordingMetrics) InvocationStarted(handler string, reason pb.HandlerInvokeType) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.started = append(m.started, handler+" "+reason.String())
+}
+
+func (m *recordingMetrics) InvocationFinished(outcome InvocationOutcome) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.finished = append(m.finished, outcome)
+}
+
+func (m *recordingMetrics) InvocationNotRun(handler string, reason pb.HandlerInvokeType, code string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.notRun = append(m.notRun, handler+" "+code)
+}
+
+func (m *recordingMetrics) ReconnectAttempted() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.reconnects++
+}
+
+func (m *recordingMetrics) ConnectionStateChanged(from ConnectionState, to ConnectionState) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.states = append(m.states, to)
+}
+
+func runMetricsHelper(t *testing.T, handler InvocableHandler, timeoutMs int32) *recordingMetrics {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+	agent, mock := createAgent(controller)
+	metrics := &recordingMetrics{}
+	agent.metrics = metrics
+
+	mock.agentStub.EXPECT().RegisterHandler(gomock.Any(), gomock.Any()).Return(&pb.RegisterHandlerResponse{Id: "1"}, nil)
+	_, err := agent.RegisterInvocableHandler(handler, WithName("syncHandler"))
+	require.NoError(t, err)
+
+	invoke := invokeMessage("1", "inv-1")
+	invoke.GetInvoke().TimeoutMs = timeoutMs
+	mock.agentStub.EXPECT().Dispatch(gomock.Any(), gomock.Any()).Return(workCompletedStream(invoke), nil)
+	mock.agentStub.EXPECT().ReportInvocation(gomock.Any(), gomock.Any(), gomock.Any()).Return(&pb.ReportInvocationResponse{}, nil)
+
+	require.NoError(t, agent.Run(context.Background()))
+	return metrics
+}
+
+func TestMetricsInvocation(t *testing.T) {
+	metrics := runMetricsHelper(t, func(ctx HandlerContext) (any, error) {
+		time.Sleep(time.Millisecond)
+		return "ok", nil
+	}, 0)
+
+	require.Equal(t, []string{"syncHandler INVOKE"}, metrics.started)
+	require.Len(t, metrics.finished, 1)
+	outcome := metrics.finished[0]
+	require.Equal(t, "syncHandler", outcome.Handler)
+	require.Equal(t, pb.HandlerInvokeType_INVOKE, outcome.Reason)
+	require.Empty(t, outcome.ErrorCode)
+	require.False(t, outcome.Panicked)
+	require.GreaterOrEqual(t, outcome.Duration, time.Millisecond)
+	require.Equal(t, []ConnectionState{ConnectionConnecting, ConnectionConnected, ConnectionIdle}, metrics.states)
+}
+
+func TestMetricsInvocationError(t *testing.T) {
+	metrics := runMetricsHelper(t, func(ctx HandlerContext) (any, error) {
+		return nil, NewHandlerError("bad_data", errors.New("bad data"))
+	}, 0)
+	require.Equal(t, "bad_data", metrics.finished[0].ErrorCode)
+	require.False(t, metrics.finished[0].Panicked)
+}
+
+func TestMetricsInvocationPanic(t *testing.T) {
+	metrics := runMetricsHelper(t, func(ctx HandlerContext) (any, error) {
+		panic("boom")
+	}, 0)
+	require.Equal(t, ErrorCodeUnexpected, metrics.finished[0].ErrorCode)
+	require.True(t, metrics.finished[0].Panicked)
+}
+
+func TestMetricsInvocationTimeout(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	metrics := runMetricsHelper(t, func(ctx HandlerContext) (any, error) {
+		<-release
+		return nil, nil
+	}, 10)
+
+	// the timeout is reported while the handler is still running
+	require.Equal(t, ErrorCodeTimeout, metrics.finished[0].ErrorCode)
+}
+
+func TestMetricsInvocationNotRun(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+	agent, mock := createAgent(controller)
+	metrics := &recordingMetrics{}
+	agent.metrics = metrics
+
+	release := make(chan struct{})
+	mock.agentStub.EXPECT().RegisterHandler(gomock.Any(), gomock.Any()).Return(&pb.RegisterHandlerResponse{Id: "1"}, nil)
+	_, err := agent.RegisterHandler(func(ctx HandlerContext) error {
+		<-release
+		return nil
+	}, WithName("syncHandler"), WithSingleton(SingletonSkip))
+	require.NoError(t, err)
+
+	mock.agentStub.EXPECT().Dispatch(gomock.Any(), gomock.Any()).Return(workCompletedStream(
+		invokeMessage("1", "inv-1"),
+		invokeMessage("1", "inv-2"),
+	), nil)
+	mock.agentStub.EXPECT().ReportInvocation(gomock.Any(), gomock.Any(), gomock.Any()).Times(2).Return(&pb.ReportInvocationResponse{}, nil)
+
+	runErr := make(chan error)
+	go func() {
+		runErr <- agent.Run(context.Background())
+	}()
+
+	require.Eventually(t, func() bool {
+		metrics.mu.Lock()
+		defer metrics.mu.Unlock()
+		return len(metrics.notRun) == 1
+	}, time.Second, time.Millisecond)
+	close(release)
+	require.NoError(t, <-runErr)
+
+	require.Equal(t, []string{"syncHandler " + ErrorCodeSkipped}, metrics.notRun)
+	require.Len(t, metrics.started, 1)
+	require.Len(t, metrics.finished, 1)
+}
+
+func TestWithNilMetrics(t *testing.T) {
+	agent := NewAxonAgent(WithMetrics(nil))
+	require.Equal(t, nopMetrics{}, agent.metrics)
+}
+
+func TestWithNilTracing(t *testing.T) {
+	ao := defaultAgentOptions()
+	WithTracerProvider(nil)(ao)
+	WithTextMapPropagator(nil)(ao)
+	require.Equal(t, noop.NewTracerProvider(), ao.tracerProvider)
+	require.Equal(t, defaultPropagator(), ao.propagator)
+
+	agent := NewAxonAgent(WithTracerProvider(nil), WithTextMapPropagator(nil))
+	require.NotNil(t, agent.tracer)
+}
+
+func TestMetricsReconnect(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+	agent, mock := createAgent(controller)
+	metrics := &recordingMetrics{}
+	agent.metrics = metrics
+	agent.sleepOnError = time.Millisecond
+	agent.backoff = ConstantBackoff(time.Millisecond)
+
+	gomock.InOrder(
+		mock.agentStub.EXPECT().Dispatch(gomock.Any(), gomock.Any()).Return(nil, status.Error(codes.Unavailable, "down")),
+		mock.agentStub.EXPECT().Dispatch(gomock.Any(), gomock.Any()).Return(nil, status.Error(codes.Unavailable, "down")),
+		mock.agentStub.EXPECT().Dispatch(gomock.Any(), gomock.Any()).Return(workCompletedStream(), nil),
+	)
+
+	require.NoError(t, agent.Run(context.Background()))
+	require.Equal(t, 2, metrics.reconnects)
+}
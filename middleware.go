@@ -0,0 +1,49 @@
+package axon
+
+// Middleware wraps handler execution with cross-cutting behavior such as logging,
+// auth checks or argument validation.  A middleware calls next to run the rest of
+// the chain and the handler, and can inspect or replace the result and error.
+// Handlers registered with RegisterHandler are adapted to an InvocableHandler
+// returning a nil result.
+//
+// Panics in the handler propagate through the middleware, so a middleware can
+// recover to enrich a panic, and re-panic to have it reported as usual.
+type Middleware func(next InvocableHandler) InvocableHandler
+
+// Use adds middleware run around every handler, outside any middleware added with
+// WithMiddleware.  Middleware runs in the order it is added, the first being the
+// outermost.  Use must be called before Run.
+func (a *Agent) Use(middleware ...Middleware) {
+	a.middleware = append(a.middleware, middleware...)
+}
+
+// WithMiddleware adds middleware run around this handler, inside any middleware
+// added with Agent.Use
+func WithMiddleware(middleware ...Middleware) RegisterHandlerOption {
+	return func(o *registerHandlerOptions) {
+		o.middleware = append(o.middleware, middleware...)
+	}
+}
+
+// chainMiddleware wraps handler so that the first middleware runs outermost
+func chainMiddleware(handler InvocableHandler, middleware ...[]Middleware) InvocableHandler {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		for j := len(middleware[i]) - 1; j >= 0; j-- {
+			handler = middleware[i][j](handler)
+		}
+	}
+	return handler
+}
+
+// asInvocableHandler adapts a registered handler so middleware can wrap it
+func asInvocableHandler(handler any) (InvocableHandler, bool) {
+	switch h := handler.(type) {
+	case Handler:
+		return func(ctx HandlerContext) (any, error) {
+			return nil, h(ctx)
+		}, true
+	case InvocableHandler:
+		return h, true
+	}
+	return nil, false
+}
@@ -0,0 +1,157 @@
+package axon
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	pb "github.com/cortexapps/axon-go/.generated/proto/github.com/cortexapps/axon"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+)
+
+func recordingMiddleware(name string, calls *[]string) Middleware {
+	return func(next InvocableHandler) InvocableHandler {
+		return func(ctx HandlerContext) (any, error) {
+			*calls = append(*calls, name+" before")
+			result, err := next(ctx)
+			*calls = append(*calls, name+" after")
+			return result, err
+		}
+	}
+}
+
+func middlewareContext() HandlerContext {
+	invoke := &pb.DispatchHandlerInvoke{HandlerName: "test", Reason: pb.HandlerInvokeType_WEBHOOK}
+	return NewHandlerContext(invoke, context.Background(), nil, zap.NewNop())
+}
+
+func TestMiddlewareOrder(t *testing.T) {
+	var calls []string
+	agent := NewAxonAgent()
+	agent.Use(recordingMiddleware("agent1", &calls), recordingMiddleware("agent2", &calls))
+
+	info := &handlerInfo{
+		handler: Handler(func(ctx HandlerContext) error {
+			calls = append(calls, "handler")
+			return nil
+		}),
+		middleware: []Middleware{recordingMiddleware("handler1", &calls), recordingMiddleware("handler2", &calls)},
+	}
+
+	result, _, err := agent.executeHandlerWithRecover(info, middlewareContext())
+	require.NoError(t, err)
+	require.Nil(t, result)
+	require.Equal(t, []string{
+		"agent1 before", "agent2 before", "handler1 before", "handler2 before",
+		"handler",
+		"handler2 after", "handler1 after", "agent2 after", "agent1 after",
+	}, calls)
+}
+
+func TestMiddlewareReplacesResult(t *testing.T) {
+	agent := NewAxonAgent()
+	agent.Use(func(next InvocableHandler) InvocableHandler {
+		return func(ctx HandlerContext) (any, error) {
+			result, err := next(ctx)
+			if err != nil {
+				return nil, err
+			}
+			return map[string]any{"handler": InvokeFromContext(ctx).HandlerName, "result": result}, nil
+		}
+	})
+
+	info := &handlerInfo{
+		handler: InvocableHandler(func(ctx HandlerContext) (any, error) {
+			return "ok", nil
+		}),
+	}
+
+	result, _, err := agent.executeHandlerWithRecover(info, middlewareContext())
+	require.NoError(t, err)
+	require.Equal(t, map[string]any{"handler": "test", "result": "ok"}, result)
+}
+
+func TestMiddlewareShortCircuits(t *testing.T) {
+	errForbidden := NewHandlerError("forbidden", errors.New("webhooks are not allowed"))
+	called := false
+
+	agent := NewAxonAgent()
+	info := &handlerInfo{
+		handler: Handler(func(ctx HandlerContext) error {
+			called = true
+			return nil
+		}),
+		middleware: []Middleware{func(next InvocableHandler) InvocableHandler {
+			return func(ctx HandlerContext) (any, error) {
+				if InvokeFromContext(ctx).Reason == pb.HandlerInvokeType_WEBHOOK {
+					return nil, errForbidden
+				}
+				return next(ctx)
+			}
+		}},
+	}
+
+	_, _, err := agent.executeHandlerWithRecover(info, middlewareContext())
+	require.ErrorIs(t, err, errForbidden)
+	require.False(t, called)
+}
+
+func TestMiddlewareEnrichesPanic(t *testing.T) {
+	agent := NewAxonAgent()
+	agent.Use(func(next InvocableHandler) InvocableHandler {
+		return func(ctx HandlerContext) (any, error) {
+			defer func() {
+				if r := recover(); r != nil {
+					panic(fmt.Sprintf("%s: %v", InvokeFromContext(ctx).HandlerName, r))
+				}
+			}()
+			return next(ctx)
+		}
+	})
+
+	info := &handlerInfo{
+		handler: Handler(func(ctx HandlerContext) error {
+			panic("boom")
+		}),
+	}
+
+	_, _, err := agent.executeHandlerWithRecover(info, middlewareContext())
+	require.EqualError(t, err, "panic in handler: test: boom")
+}
+
+func TestWithMiddleware(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+	agent, mock := createAgent(controller)
+
+	mock.agentStub.EXPECT().RegisterHandler(gomock.Any(), gomock.Any()).Return(&pb.RegisterHandlerResponse{Id: "1"}, nil)
+	_, err := agent.RegisterInvocableHandler(func(ctx HandlerContext) (any, error) {
+		return "result", nil
+	}, WithName("syncHandler"), WithMiddleware(func(next InvocableHandler) InvocableHandler {
+		return func(ctx HandlerContext) (any, error) {
+			result, err := next(ctx)
+			return fmt.Sprintf("wrapped %v", result), err
+		}
+	}))
+	require.NoError(t, err)
+
+	reports := make(chan *pb.ReportInvocationRequest, 1)
+	mock.agentStub.EXPECT().Dispatch(gomock.Any(), gomock.Any()).Return(workCompletedStream(invokeMessage("1", "inv-1")), nil)
+	mock.agentStub.EXPECT().ReportInvocation(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, req *pb.ReportInvocationRequest, opts ...grpc.CallOption) (*pb.ReportInvocationResponse, error) {
+			reports <- req
+			return &pb.ReportInvocationResponse{}, nil
+		})
+
+	require.NoError(t, agent.Run(context.Background()))
+	require.Equal(t, "wrapped result", (<-reports).GetResult().GetValue())
+}
+
+func TestInvokeFromContext(t *testing.T) {
+	require.Nil(t, InvokeFromContext(context.Background()))
+	require.Equal(t, "test", InvokeFromContext(middlewareContext()).HandlerName)
+}
@@ -1,42 +1,138 @@
 package axon
 
 import (
+	"net"
+	"os"
+	"strconv"
+	"syscall"
 	"time"
 
 	"github.com/cortexapps/axon-go/version"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
+	"google.golang.org/grpc"
 )
 
 type Option func(*agentOptions)
 
 type agentOptions struct {
-	host         string
-	port         int
-	loglevel     zapcore.Level
-	loggerConfig zap.Config
-	sleepOnError time.Duration
-	version      string
+	target        string
+	endpoints     []string
+	endpointMode  EndpointMode
+	tlsConfig     *TLSConfig
+	dialOptions   []grpc.DialOption
+	loglevel      zapcore.Level
+	loggerConfig  zap.Config
+	sleepOnError  time.Duration
+	version       string
+	resultEncoder ResultEncoder
+
+	maxConcurrency int
+	queueDepth     int
+	overflowPolicy OverflowPolicy
+
+	backoff    BackoffPolicy
+	stateHooks []ConnectionStateHook
+
+	unregisterOnStop bool
+	shutdownSignals  []os.Signal
+	shutdownTimeout  time.Duration
+
+	locker        Locker
+	leaseDuration time.Duration
+
+	metrics Metrics
+
+	tracerProvider trace.TracerProvider
+	propagator     propagation.TextMapPropagator
+
+	health HealthConfig
+
+	logLimits LogLimits
+}
+
+func defaultPropagator() propagation.TextMapPropagator {
+	return propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{})
 }
 
 func defaultAgentOptions() *agentOptions {
 	return &agentOptions{
-		host:         "localhost",
-		port:         50051,
-		loglevel:     zapcore.InfoLevel,
-		loggerConfig: zap.NewDevelopmentConfig(),
-		sleepOnError: time.Second * 5,
-		version:      version.Client,
+		target:         "localhost:50051",
+		loglevel:       zapcore.InfoLevel,
+		loggerConfig:   zap.NewDevelopmentConfig(),
+		sleepOnError:   time.Second * 5,
+		version:        version.Client,
+		resultEncoder:  JSONResultEncoder(),
+		queueDepth:     -1,
+		backoff:        DefaultBackoffPolicy(),
+		metrics:        nopMetrics{},
+		tracerProvider: noop.NewTracerProvider(),
+		propagator:     defaultPropagator(),
+		logLimits:      DefaultLogLimits(),
 	}
 }
 
 func WithHostport(host string, port int) Option {
+	return WithTarget(net.JoinHostPort(host, strconv.Itoa(port)))
+}
+
+// WithTarget connects to the agent at a gRPC target URI, such as "dns:///axon:50051"
+// or "unix:///var/run/axon.sock", rather than a host and port
+func WithTarget(target string) Option {
+	return func(a *agentOptions) {
+		a.target = target
+	}
+}
+
+// WithUnixSocket connects to the agent over the Unix domain socket at path, for
+// sidecar deployments sharing a volume with the agent
+func WithUnixSocket(path string) Option {
+	return WithTarget("unix:" + path)
+}
+
+// WithEndpoints connects to several agents for high availability, each a gRPC
+// target as accepted by WithTarget.  The dispatch stream is served by one endpoint
+// at a time, starting with the first, and fails over to the next when it becomes
+// unavailable.  Mode controls whether handlers are registered with every endpoint
+// or only the one serving the dispatch stream.
+func WithEndpoints(mode EndpointMode, targets ...string) Option {
 	return func(a *agentOptions) {
-		a.host = host
-		a.port = port
+		a.endpoints = targets
+		a.endpointMode = mode
 	}
 }
 
+// WithTLS connects to the agent over TLS, or mTLS when a client certificate
+// is configured, rather than the default plaintext connection
+func WithTLS(config TLSConfig) Option {
+	return func(a *agentOptions) {
+		a.tlsConfig = &config
+	}
+}
+
+// WithDialOptions adds options used when dialing the agent, such as keepalive
+// parameters, message size limits or per-RPC credentials
+func WithDialOptions(options ...grpc.DialOption) Option {
+	return func(a *agentOptions) {
+		a.dialOptions = append(a.dialOptions, options...)
+	}
+}
+
+// WithUnaryInterceptor adds interceptors to unary calls to the agent and the
+// Cortex API.  Interceptors run in the order they are added.
+func WithUnaryInterceptor(interceptors ...grpc.UnaryClientInterceptor) Option {
+	return WithDialOptions(grpc.WithChainUnaryInterceptor(interceptors...))
+}
+
+// WithStreamInterceptor adds interceptors to streaming calls to the agent, such
+// as the dispatch stream.  Interceptors run in the order they are added.
+func WithStreamInterceptor(interceptors ...grpc.StreamClientInterceptor) Option {
+	return WithDialOptions(grpc.WithChainStreamInterceptor(interceptors...))
+}
+
 func WithLoggerConfig(config zap.Config) Option {
 	return func(a *agentOptions) {
 		a.loggerConfig = config
@@ -49,8 +145,147 @@ func WithLogLevel(level zapcore.Level) Option {
 	}
 }
 
+// WithSleepOnError waits a constant duration before retrying after an error.  A
+// duration of zero makes Run exit on the first error rather than retrying.
 func WithSleepOnError(duration time.Duration) Option {
 	return func(a *agentOptions) {
 		a.sleepOnError = duration
+		if duration > 0 {
+			a.backoff = ConstantBackoff(duration)
+		}
+	}
+}
+
+// WithBackoff sets the policy for retrying after errors, replacing the default
+// exponential backoff
+func WithBackoff(policy BackoffPolicy) Option {
+	return func(a *agentOptions) {
+		a.backoff = policy
+	}
+}
+
+// WithConnectionStateHook registers a hook called whenever the connection state
+// of the dispatch stream changes
+func WithConnectionStateHook(hook ConnectionStateHook) Option {
+	return func(a *agentOptions) {
+		a.stateHooks = append(a.stateHooks, hook)
+	}
+}
+
+// WithResultEncoder sets the encoder used to serialize values returned by
+// InvocableHandlers, the default is JSONResultEncoder.  A nil encoder restores
+// the default.
+func WithResultEncoder(encoder ResultEncoder) Option {
+	return func(a *agentOptions) {
+		if encoder == nil {
+			encoder = JSONResultEncoder()
+		}
+		a.resultEncoder = encoder
+	}
+}
+
+// WithMaxConcurrentInvocations limits how many handler invocations can run at
+// once across the agent, further invocations are queued until a running one finishes
+func WithMaxConcurrentInvocations(limit int) Option {
+	return func(a *agentOptions) {
+		a.maxConcurrency = limit
+	}
+}
+
+// WithInvocationQueue bounds the number of invocations across the agent that can
+// wait for a concurrency slot, applying policy when the queue is full.  By default
+// the queue is unbounded.
+func WithInvocationQueue(depth int, policy OverflowPolicy) Option {
+	return func(a *agentOptions) {
+		a.queueDepth = depth
+		a.overflowPolicy = policy
+	}
+}
+
+// WithUnregisterOnStop unregisters all handlers from the agent when Stop is called
+func WithUnregisterOnStop() Option {
+	return func(a *agentOptions) {
+		a.unregisterOnStop = true
+	}
+}
+
+// WithShutdownSignals makes Run call Stop when one of signals is received, waiting up
+// to drainTimeout for running handlers to finish.  With no signals, SIGTERM and
+// SIGINT are used, which suits container deployments.
+func WithShutdownSignals(drainTimeout time.Duration, signals ...os.Signal) Option {
+	return func(a *agentOptions) {
+		if len(signals) == 0 {
+			signals = []os.Signal{syscall.SIGTERM, os.Interrupt}
+		}
+		a.shutdownSignals = signals
+		a.shutdownTimeout = drainTimeout
+	}
+}
+
+// WithLeaderElection elects a leader among replicas of the agent using locker, and
+// only the leader registers RUN_INTERVAL and CRON_SCHEDULE handlers.  Other handlers
+// are registered by every replica.  The leader renews its lease every third of
+// leaseDuration, and another replica takes over once the lease expires.  A
+// leaseDuration that is not positive uses DefaultLeaseDuration.
+func WithLeaderElection(locker Locker, leaseDuration time.Duration) Option {
+	return func(a *agentOptions) {
+		if leaseDuration <= 0 {
+			leaseDuration = DefaultLeaseDuration
+		}
+		a.locker = locker
+		a.leaseDuration = leaseDuration
+	}
+}
+
+// WithMetrics records handler invocation and connection measurements with metrics,
+// nothing is recorded if it is nil
+func WithMetrics(metrics Metrics) Option {
+	return func(a *agentOptions) {
+		if metrics == nil {
+			metrics = nopMetrics{}
+		}
+		a.metrics = metrics
+	}
+}
+
+// WithTracerProvider traces handler invocations and the Cortex API calls they make
+// with provider.  Each invocation gets a span, which is the parent of spans started
+// by the handler from its context.  Nothing is traced if it is nil.
+func WithTracerProvider(provider trace.TracerProvider) Option {
+	return func(a *agentOptions) {
+		if provider == nil {
+			provider = noop.NewTracerProvider()
+		}
+		a.tracerProvider = provider
+	}
+}
+
+// WithTextMapPropagator sets how trace context is propagated to the agent in gRPC
+// metadata, the default is W3C trace context and baggage, which is also used if it
+// is nil
+func WithTextMapPropagator(propagator propagation.TextMapPropagator) Option {
+	return func(a *agentOptions) {
+		if propagator == nil {
+			propagator = defaultPropagator()
+		}
+		a.propagator = propagator
+	}
+}
+
+// WithHealthServer makes Run serve /healthz and /readyz on config.Addr, for use as
+// liveness and readiness probes.  The server stops when Run returns, unless Run gave
+// up reconnecting, in which case it keeps failing /healthz until Stop is called or
+// Run is called again, reusing the server.  See Agent.HealthHandler to mount the endpoints on an existing server instead.
+func WithHealthServer(config HealthConfig) Option {
+	return func(a *agentOptions) {
+		a.health = config
+	}
+}
+
+// WithInvocationLogLimits caps the handler logs reported with each invocation, the
+// default is DefaultLogLimits
+func WithInvocationLogLimits(limits LogLimits) Option {
+	return func(a *agentOptions) {
+		a.logLimits = limits
 	}
 }
@@ -0,0 +1,103 @@
+package axon
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"gopkg.in/yaml.v3"
+)
+
+// EncodedResult is the serialized form of a value returned by an InvocableHandler.
+// The agent protocol reports a result as a plain string with no content type, so
+// whoever reads the result needs to know the format the encoder produces.
+type EncodedResult struct {
+	Value string
+}
+
+// ResultEncoder serializes the values returned by InvocableHandlers into the
+// invocation result reported to the agent.  Encode is never called with a nil result.
+type ResultEncoder interface {
+	Encode(result any) (*EncodedResult, error)
+}
+
+// ResultEncoderFunc adapts a function to a ResultEncoder
+type ResultEncoderFunc func(result any) (*EncodedResult, error)
+
+func (f ResultEncoderFunc) Encode(result any) (*EncodedResult, error) {
+	return f(result)
+}
+
+// JSONResultEncoder returns the default encoder.  Strings and byte slices are passed
+// through as text, protobuf messages are encoded with protojson and everything else
+// with encoding/json.
+func JSONResultEncoder() ResultEncoder {
+	return ResultEncoderFunc(func(result any) (*EncodedResult, error) {
+		if encoded, ok := encodeRawResult(result); ok {
+			return encoded, nil
+		}
+
+		var value []byte
+		var err error
+		if msg, ok := result.(proto.Message); ok {
+			value, err = protojson.Marshal(msg)
+		} else {
+			value, err = json.Marshal(result)
+		}
+		if err != nil {
+			return nil, err
+		}
+		return &EncodedResult{Value: string(value)}, nil
+	})
+}
+
+// YAMLResultEncoder returns an encoder that serializes results as YAML.  Strings and
+// byte slices are passed through as text.
+func YAMLResultEncoder() ResultEncoder {
+	return ResultEncoderFunc(func(result any) (*EncodedResult, error) {
+		if encoded, ok := encodeRawResult(result); ok {
+			return encoded, nil
+		}
+
+		value, err := yaml.Marshal(result)
+		if err != nil {
+			return nil, err
+		}
+		return &EncodedResult{Value: string(value)}, nil
+	})
+}
+
+func encodeRawResult(result any) (*EncodedResult, bool) {
+	switch v := result.(type) {
+	case json.RawMessage:
+		return &EncodedResult{Value: string(v)}, true
+	case string:
+		return &EncodedResult{Value: v}, true
+	case []byte:
+		return &EncodedResult{Value: string(v)}, true
+	}
+	return nil, false
+}
+
+func isNilResult(result any) bool {
+	if result == nil {
+		return true
+	}
+	v := reflect.ValueOf(result)
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Map, reflect.Slice, reflect.Interface:
+		return v.IsNil()
+	}
+	return false
+}
+
+func (a *Agent) encodeResult(result any) (encoded *EncodedResult, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic in result encoder: %v", r)
+		}
+	}()
+	return a.resultEncoder.Encode(result)
+}
@@ -0,0 +1,88 @@
+package axon
+
+import (
+	"encoding/json"
+	"testing"
+
+	pb "github.com/cortexapps/axon-go/.generated/proto/github.com/cortexapps/axon"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+func TestJSONResultEncoder(t *testing.T) {
+	encoder := JSONResultEncoder()
+
+	cases := []struct {
+		name   string
+		result any
+		value  string
+		json   bool
+	}{
+		{"string", "hello", "hello", false},
+		{"bytes", []byte("hello"), "hello", false},
+		{"raw json", json.RawMessage(`{"a":1}`), `{"a":1}`, true},
+		{"map", map[string]any{"message": "hi"}, `{"message":"hi"}`, true},
+		{"struct", testResult{Entity: "e", Count: 1}, `{"entity":"e","count":1}`, true},
+		{"int", 42, "42", true},
+		{"proto", &pb.Error{Code: "c", Message: "m"}, `{"code":"c","message":"m"}`, true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			encoded, err := encoder.Encode(c.result)
+			require.NoError(t, err)
+			if c.json {
+				require.JSONEq(t, c.value, encoded.Value)
+			} else {
+				require.Equal(t, c.value, encoded.Value)
+			}
+		})
+	}
+
+	_, err := encoder.Encode(make(chan int))
+	require.Error(t, err)
+}
+
+func TestYAMLResultEncoder(t *testing.T) {
+	encoded, err := YAMLResultEncoder().Encode(map[string]any{"message": "hi"})
+	require.NoError(t, err)
+	require.Equal(t, "message: hi\n", encoded.Value)
+}
+
+func TestInvokeHandlerResultEncoded(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+
+	theHandler := func(ctx HandlerContext) (any, error) {
+		return map[string]any{"message": "hello"}, nil
+	}
+
+	executeHandlerHelper(t, controller, theHandler, 1000, func(req *pb.ReportInvocationRequest) {
+		require.Nil(t, req.GetError())
+		require.JSONEq(t, `{"message":"hello"}`, req.GetResult().Value)
+	})
+}
+
+func TestInvokeHandlerResultEncodingError(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+
+	theHandler := func(ctx HandlerContext) (any, error) {
+		return make(chan int), nil
+	}
+
+	executeHandlerHelper(t, controller, theHandler, 1000, func(req *pb.ReportInvocationRequest) {
+		reportedErr := req.GetError()
+		require.NotNil(t, reportedErr)
+		require.Equal(t, ErrorCodeEncoding, reportedErr.Code)
+		require.Nil(t, req.GetResult())
+	})
+}
+
+func TestWithNilResultEncoder(t *testing.T) {
+	agent := NewAxonAgent(WithResultEncoder(nil))
+
+	encoded, err := agent.encodeResult(map[string]any{"message": "hi"})
+	require.NoError(t, err)
+	require.JSONEq(t, `{"message":"hi"}`, encoded.Value)
+}
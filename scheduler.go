@@ -0,0 +1,273 @@
+package axon
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// OverflowPolicy controls what happens to an invocation that arrives while the
+// queue of invocations waiting for a concurrency slot is full
+type OverflowPolicy int
+
+const (
+	// OverflowBlock waits for room in the queue, which pauses the dispatch of
+	// any further invocations until then
+	OverflowBlock OverflowPolicy = iota
+	// OverflowReject reports the new invocation as failed with ErrorCodeRejected
+	OverflowReject
+	// OverflowDropOldest reports the oldest queued invocation as failed with
+	// ErrorCodeDropped and queues the new one in its place
+	OverflowDropOldest
+)
+
+func (p OverflowPolicy) String() string {
+	switch p {
+	case OverflowBlock:
+		return "block"
+	case OverflowReject:
+		return "reject"
+	case OverflowDropOldest:
+		return "drop-oldest"
+	}
+	return fmt.Sprintf("OverflowPolicy(%d)", int(p))
+}
+
+// concurrencyPool tracks the limits for either the whole agent or a single handler.
+// A limit of zero is unlimited, as is a negative queue depth.
+type concurrencyPool struct {
+	limit      int
+	queueDepth int
+	policy     OverflowPolicy
+	rejectCode string
+
+	running int
+	queued  int
+}
+
+func newConcurrencyPool(limit int, queueDepth int, policy OverflowPolicy) *concurrencyPool {
+	return &concurrencyPool{
+		limit:      limit,
+		queueDepth: queueDepth,
+		policy:     policy,
+		rejectCode: ErrorCodeRejected,
+	}
+}
+
+// newHandlerPool creates the pool for a handler from its registration options
+func newHandlerPool(opts *registerHandlerOptions) (*concurrencyPool, error) {
+	if opts.maxConcurrency < 0 {
+		return nil, fmt.Errorf("invalid max concurrency %d", opts.maxConcurrency)
+	}
+
+	if opts.singleton == nil {
+		return newConcurrencyPool(opts.maxConcurrency, opts.queueDepth, opts.overflowPolicy), nil
+	}
+
+	if opts.maxConcurrency > 1 {
+		return nil, fmt.Errorf("singleton handlers cannot have a max concurrency of %d", opts.maxConcurrency)
+	}
+	if opts.queueDepth >= 0 {
+		return nil, errors.New("singleton handlers cannot have a queue")
+	}
+
+	pool := newConcurrencyPool(1, 0, OverflowReject)
+	switch *opts.singleton {
+	case SingletonSkip:
+	case SingletonQueueOne:
+		pool.queueDepth = 1
+	default:
+		return nil, fmt.Errorf("unknown singleton mode %d", *opts.singleton)
+	}
+	pool.rejectCode = ErrorCodeSkipped
+	return pool, nil
+}
+
+func (p *concurrencyPool) hasSlot() bool {
+	return p.limit <= 0 || p.running < p.limit
+}
+
+func (p *concurrencyPool) queueFull() bool {
+	return p.queueDepth >= 0 && p.queued >= p.queueDepth
+}
+
+type slotState int
+
+const (
+	slotQueued slotState = iota
+	slotRunning
+	slotDone
+)
+
+// slot is a claim on a concurrency slot for a single invocation
+type slot struct {
+	s     *scheduler
+	pool  *concurrencyPool
+	state slotState
+	ready chan struct{}
+	err   error
+}
+
+// wait blocks until the slot is granted, returning an error if it was
+// dropped from the queue or ctx ended first
+func (sl *slot) wait(ctx context.Context) error {
+	select {
+	case <-sl.ready:
+		return sl.err
+	case <-ctx.Done():
+	}
+
+	sl.s.mu.Lock()
+	defer sl.s.mu.Unlock()
+	switch sl.state {
+	case slotQueued:
+		sl.s.remove(sl)
+	case slotRunning:
+		sl.s.releaseLocked(sl)
+	}
+	return ctx.Err()
+}
+
+// release gives up the slot once the invocation has finished
+func (sl *slot) release() {
+	sl.s.mu.Lock()
+	defer sl.s.mu.Unlock()
+	sl.s.releaseLocked(sl)
+}
+
+var errSchedulerQueueFull = errors.New("invocation queue is full")
+
+// scheduler grants concurrency slots to invocations, limited both across the
+// agent and per handler, queueing invocations in arrival order until they can run
+type scheduler struct {
+	mu    sync.Mutex
+	cond  *sync.Cond
+	agent *concurrencyPool
+	queue []*slot
+}
+
+func newScheduler(agent *concurrencyPool) *scheduler {
+	s := &scheduler{
+		agent: agent,
+	}
+	s.cond = sync.NewCond(&s.mu)
+	return s
+}
+
+// acquire claims a slot for an invocation of the handler with the specified pool,
+// applying the overflow policy of whichever pool has a full queue.  The returned
+// slot may still be queued, callers must wait on it before running.
+func (s *scheduler) acquire(ctx context.Context, pool *concurrencyPool) (*slot, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stop := context.AfterFunc(ctx, func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.cond.Broadcast()
+	})
+	defer stop()
+
+	sl := &slot{
+		s:     s,
+		pool:  pool,
+		ready: make(chan struct{}),
+	}
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		if pool.hasSlot() && s.agent.hasSlot() {
+			s.start(sl)
+			return sl, nil
+		}
+
+		full := pool
+		if !pool.queueFull() {
+			full = nil
+			if s.agent.queueFull() {
+				full = s.agent
+			}
+		}
+
+		if full == nil {
+			sl.state = slotQueued
+			pool.queued++
+			s.agent.queued++
+			s.queue = append(s.queue, sl)
+			return sl, nil
+		}
+
+		switch full.policy {
+		case OverflowReject:
+			return nil, NewHandlerError(full.rejectCode, errSchedulerQueueFull)
+		case OverflowDropOldest:
+			oldest := s.oldest(full)
+			if oldest == nil {
+				// zero length queue, there is nothing to drop in favor of this invocation
+				return nil, NewHandlerError(full.rejectCode, errSchedulerQueueFull)
+			}
+			s.remove(oldest)
+			oldest.state = slotDone
+			oldest.err = NewHandlerError(ErrorCodeDropped, errors.New("dropped from the invocation queue"))
+			close(oldest.ready)
+		default:
+			s.cond.Wait()
+		}
+	}
+}
+
+func (s *scheduler) start(sl *slot) {
+	sl.state = slotRunning
+	sl.pool.running++
+	s.agent.running++
+	close(sl.ready)
+}
+
+// oldest returns the oldest queued slot counted against pool
+func (s *scheduler) oldest(pool *concurrencyPool) *slot {
+	for _, sl := range s.queue {
+		if pool == s.agent || sl.pool == pool {
+			return sl
+		}
+	}
+	return nil
+}
+
+func (s *scheduler) remove(sl *slot) {
+	for i, queued := range s.queue {
+		if queued == sl {
+			s.queue = append(s.queue[:i], s.queue[i+1:]...)
+			sl.pool.queued--
+			s.agent.queued--
+			s.cond.Broadcast()
+			return
+		}
+	}
+}
+
+func (s *scheduler) releaseLocked(sl *slot) {
+	if sl.state != slotRunning {
+		return
+	}
+	sl.state = slotDone
+	sl.pool.running--
+	s.agent.running--
+
+	// start any queued invocations that now fit, in arrival order
+	for i := 0; i < len(s.queue); {
+		next := s.queue[i]
+		if !next.pool.hasSlot() || !s.agent.hasSlot() {
+			i++
+			continue
+		}
+		s.queue = append(s.queue[:i], s.queue[i+1:]...)
+		next.pool.queued--
+		s.agent.queued--
+		s.start(next)
+	}
+	s.cond.Broadcast()
+}
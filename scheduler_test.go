@@ -0,0 +1,276 @@
+package axon
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	pb "github.com/cortexapps/axon-go/.generated/proto/github.com/cortexapps/axon"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+	"google.golang.org/grpc"
+)
+
+func isReady(sl *slot) bool {
+	select {
+	case <-sl.ready:
+		return true
+	default:
+		return false
+	}
+}
+
+func TestSchedulerHandlerLimit(t *testing.T) {
+	s := newScheduler(newConcurrencyPool(0, -1, OverflowBlock))
+	pool := newConcurrencyPool(1, -1, OverflowBlock)
+	ctx := context.Background()
+
+	first, err := s.acquire(ctx, pool)
+	require.NoError(t, err)
+	require.True(t, isReady(first))
+
+	second, err := s.acquire(ctx, pool)
+	require.NoError(t, err)
+	require.False(t, isReady(second))
+
+	// other handlers are not affected
+	other, err := s.acquire(ctx, newConcurrencyPool(1, -1, OverflowBlock))
+	require.NoError(t, err)
+	require.True(t, isReady(other))
+
+	first.release()
+	require.NoError(t, second.wait(ctx))
+	second.release()
+	other.release()
+
+	require.Zero(t, s.agent.running)
+	require.Zero(t, pool.running)
+	require.Zero(t, pool.queued)
+}
+
+func TestSchedulerAgentLimit(t *testing.T) {
+	s := newScheduler(newConcurrencyPool(1, -1, OverflowBlock))
+	ctx := context.Background()
+
+	first, err := s.acquire(ctx, newConcurrencyPool(0, -1, OverflowBlock))
+	require.NoError(t, err)
+	require.True(t, isReady(first))
+
+	second, err := s.acquire(ctx, newConcurrencyPool(0, -1, OverflowBlock))
+	require.NoError(t, err)
+	require.False(t, isReady(second))
+
+	first.release()
+	require.True(t, isReady(second))
+}
+
+func TestSchedulerReject(t *testing.T) {
+	s := newScheduler(newConcurrencyPool(0, -1, OverflowBlock))
+	pool := newConcurrencyPool(1, 1, OverflowReject)
+	ctx := context.Background()
+
+	_, err := s.acquire(ctx, pool)
+	require.NoError(t, err)
+	_, err = s.acquire(ctx, pool)
+	require.NoError(t, err)
+
+	_, err = s.acquire(ctx, pool)
+	require.Error(t, err)
+	require.Equal(t, ErrorCodeRejected, errorCode(err))
+}
+
+func TestSchedulerDropOldest(t *testing.T) {
+	s := newScheduler(newConcurrencyPool(0, -1, OverflowBlock))
+	pool := newConcurrencyPool(1, 1, OverflowDropOldest)
+	ctx := context.Background()
+
+	running, err := s.acquire(ctx, pool)
+	require.NoError(t, err)
+	queued, err := s.acquire(ctx, pool)
+	require.NoError(t, err)
+
+	newest, err := s.acquire(ctx, pool)
+	require.NoError(t, err)
+
+	err = queued.wait(ctx)
+	require.Error(t, err)
+	require.Equal(t, ErrorCodeDropped, errorCode(err))
+
+	running.release()
+	require.NoError(t, newest.wait(ctx))
+}
+
+func TestSchedulerBlock(t *testing.T) {
+	s := newScheduler(newConcurrencyPool(0, -1, OverflowBlock))
+	pool := newConcurrencyPool(1, 0, OverflowBlock)
+
+	running, err := s.acquire(context.Background(), pool)
+	require.NoError(t, err)
+
+	acquired := make(chan *slot)
+	go func() {
+		sl, err := s.acquire(context.Background(), pool)
+		require.NoError(t, err)
+		acquired <- sl
+	}()
+
+	select {
+	case <-acquired:
+		require.Fail(t, "acquire should block while the handler is at its limit")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	running.release()
+	sl := <-acquired
+	require.True(t, isReady(sl))
+
+	// blocked acquires give up when the context ends
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = s.acquire(ctx, pool)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestInvokeHandlerRejectedWhenBusy(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+	agent, mock := createAgent(controller)
+
+	id := "busy"
+	invoke := &pb.DispatchMessage{
+		Type: pb.DispatchMessageType_DISPATCH_MESSAGE_INVOKE,
+		Message: &pb.DispatchMessage_Invoke{
+			Invoke: &pb.DispatchHandlerInvoke{
+				HandlerId:   id,
+				HandlerName: "busy",
+			},
+		},
+	}
+	stream := newBidiClient(invoke, invoke, &pb.DispatchMessage{
+		Type: pb.DispatchMessageType_DISPATCH_MESSAGE_WORK_COMPLETED,
+	})
+
+	reports := []*pb.ReportInvocationRequest{}
+	mu := sync.Mutex{}
+
+	mock.agentStub.EXPECT().RegisterHandler(gomock.Any(), gomock.Any()).Return(&pb.RegisterHandlerResponse{Id: id}, nil)
+	mock.agentStub.EXPECT().Dispatch(gomock.Any(), gomock.Any()).Return(stream, nil)
+	mock.agentStub.EXPECT().ReportInvocation(gomock.Any(), gomock.Any(), gomock.Any()).Times(2).DoAndReturn(
+		func(ctx context.Context, req *pb.ReportInvocationRequest, opts ...grpc.CallOption) (*pb.ReportInvocationResponse, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			reports = append(reports, req)
+			return &pb.ReportInvocationResponse{}, nil
+		})
+
+	theHandler := func(ctx HandlerContext) error {
+		time.Sleep(50 * time.Millisecond)
+		return nil
+	}
+
+	_, err := agent.RegisterHandler(theHandler,
+		WithMaxConcurrency(1),
+		WithQueue(0, OverflowReject),
+	)
+	require.NoError(t, err)
+
+	require.NoError(t, agent.Run(context.Background()))
+
+	require.Len(t, reports, 2)
+	require.Equal(t, ErrorCodeRejected, reports[0].GetError().GetCode())
+	require.Nil(t, reports[1].GetError())
+}
+
+func TestSchedulerSingleton(t *testing.T) {
+	s := newScheduler(newConcurrencyPool(0, -1, OverflowBlock))
+	ctx := context.Background()
+
+	opts := defaultRegisterHandlerOptions()
+	WithSingleton(SingletonSkip)(opts)
+	skip, err := newHandlerPool(opts)
+	require.NoError(t, err)
+
+	running, err := s.acquire(ctx, skip)
+	require.NoError(t, err)
+	_, err = s.acquire(ctx, skip)
+	require.Equal(t, ErrorCodeSkipped, errorCode(err))
+	running.release()
+
+	opts = defaultRegisterHandlerOptions()
+	WithSingleton(SingletonQueueOne)(opts)
+	queueOne, err := newHandlerPool(opts)
+	require.NoError(t, err)
+
+	running, err = s.acquire(ctx, queueOne)
+	require.NoError(t, err)
+	queued, err := s.acquire(ctx, queueOne)
+	require.NoError(t, err)
+	require.False(t, isReady(queued))
+	_, err = s.acquire(ctx, queueOne)
+	require.Equal(t, ErrorCodeSkipped, errorCode(err))
+
+	running.release()
+	require.NoError(t, queued.wait(ctx))
+}
+
+func TestSingletonOptionConflicts(t *testing.T) {
+	opts := defaultRegisterHandlerOptions()
+	WithSingleton(SingletonSkip)(opts)
+	WithMaxConcurrency(2)(opts)
+	_, err := newHandlerPool(opts)
+	require.ErrorContains(t, err, "max concurrency")
+
+	opts = defaultRegisterHandlerOptions()
+	WithSingleton(SingletonSkip)(opts)
+	WithQueue(5, OverflowBlock)(opts)
+	_, err = newHandlerPool(opts)
+	require.ErrorContains(t, err, "cannot have a queue")
+}
+
+func TestSingletonSkipsOverlappingInvocation(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+	agent, mock := createAgent(controller)
+
+	id := "singleton"
+	invoke := &pb.DispatchMessage{
+		Type: pb.DispatchMessageType_DISPATCH_MESSAGE_INVOKE,
+		Message: &pb.DispatchMessage_Invoke{
+			Invoke: &pb.DispatchHandlerInvoke{
+				HandlerId:   id,
+				HandlerName: "singleton",
+				Reason:      pb.HandlerInvokeType_RUN_INTERVAL,
+			},
+		},
+	}
+	stream := newBidiClient(invoke, invoke, &pb.DispatchMessage{
+		Type: pb.DispatchMessageType_DISPATCH_MESSAGE_WORK_COMPLETED,
+	})
+
+	codes := make(chan string, 2)
+
+	mock.agentStub.EXPECT().RegisterHandler(gomock.Any(), gomock.Any()).Return(&pb.RegisterHandlerResponse{Id: id}, nil)
+	mock.agentStub.EXPECT().Dispatch(gomock.Any(), gomock.Any()).Return(stream, nil)
+	mock.agentStub.EXPECT().ReportInvocation(gomock.Any(), gomock.Any(), gomock.Any()).Times(2).DoAndReturn(
+		func(ctx context.Context, req *pb.ReportInvocationRequest, opts ...grpc.CallOption) (*pb.ReportInvocationResponse, error) {
+			codes <- req.GetError().GetCode()
+			return &pb.ReportInvocationResponse{}, nil
+		})
+
+	theHandler := func(ctx HandlerContext) error {
+		time.Sleep(50 * time.Millisecond)
+		return nil
+	}
+
+	_, err := agent.RegisterHandler(theHandler,
+		WithInvokeOption(pb.HandlerInvokeType_RUN_INTERVAL, "1s"),
+		WithSingleton(SingletonSkip),
+	)
+	require.NoError(t, err)
+
+	require.NoError(t, agent.Run(context.Background()))
+
+	require.Equal(t, ErrorCodeSkipped, <-codes)
+	require.Equal(t, "", <-codes)
+}
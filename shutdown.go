@@ -0,0 +1,223 @@
+package axon
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	pb "github.com/cortexapps/axon-go/.generated/proto/github.com/cortexapps/axon"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// invocation tracks a running handler invocation so it can be aborted on shutdown
+type invocation struct {
+	client   grpcClient
+	invoke   *pb.DispatchHandlerInvoke
+	span     trace.Span
+	logs     *invocationLogs
+	start    time.Time
+	abort    context.CancelFunc
+	reported atomic.Bool
+}
+
+// markReported returns true the first time it is called, the caller is then
+// responsible for reporting the invocation
+func (inv *invocation) markReported() bool {
+	return inv.reported.CompareAndSwap(false, true)
+}
+
+func (inv *invocation) isReported() bool {
+	return inv.reported.Load()
+}
+
+func (a *Agent) trackInvocation(client grpcClient, invoke *pb.DispatchHandlerInvoke, span trace.Span, abort context.CancelFunc) *invocation {
+	inv := &invocation{
+		client: client,
+		invoke: invoke,
+		span:   span,
+		logs:   newInvocationLogs(a.logLimits),
+		start:  time.Now(),
+		abort:  abort,
+	}
+	a.inFlightMu.Lock()
+	defer a.inFlightMu.Unlock()
+	a.inFlight[inv] = struct{}{}
+	a.metrics.InvocationStarted(invoke.HandlerName, invoke.Reason)
+	return inv
+}
+
+func (a *Agent) untrackInvocation(inv *invocation) {
+	a.inFlightMu.Lock()
+	defer a.inFlightMu.Unlock()
+	delete(a.inFlight, inv)
+}
+
+var errAgentStopped = errors.New("agent is shutting down")
+
+// notAcceptedError maps the error for an invocation that could not be started,
+// reporting it as a shutdown if the agent has been stopped or as cancelled if the
+// Run context was cancelled
+func (a *Agent) notAcceptedError(err error) error {
+	if a.stopCtx.Err() != nil {
+		return NewHandlerError(ErrorCodeShutdown, errAgentStopped)
+	}
+	if errors.Is(err, context.Canceled) {
+		return NewHandlerError(ErrorCodeCancelled, err)
+	}
+	return err
+}
+
+// Stop shuts down the agent.  It stops accepting new invocations, closes the dispatch
+// stream and then waits for running handlers to finish.  If ctx ends first, the
+// remaining handlers are aborted and reported with ErrorCodeShutdown and ctx.Err()
+// is returned.  Run returns once every handler has finished or been aborted.
+func (a *Agent) Stop(ctx context.Context) error {
+
+	if a.stopCtx.Err() == nil {
+		a.logger.Info("stopping agent")
+		a.stopAgent()
+	}
+
+	if a.unregisterOnStop {
+		a.unregisterAll(ctx)
+	}
+
+	drained := make(chan struct{})
+	go func() {
+		a.runningHandlers.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+		return nil
+	case <-ctx.Done():
+		a.abortAgent()
+		a.abortInFlight()
+		return ctx.Err()
+	}
+}
+
+// Shutdown is an alias for Stop
+func (a *Agent) Shutdown(ctx context.Context) error {
+	return a.Stop(ctx)
+}
+
+// abortReportTimeout bounds reporting the invocations aborted by Stop, which runs
+// after Stop's own deadline has passed
+const abortReportTimeout = 2 * time.Second
+
+// unregisterAll unregisters every registration, including those left on endpoints
+// that could not be reached, until ctx ends.  The registrations are dropped under
+// handlersMu and unregistered without holding it, so an unreachable agent does not
+// block registering handlers.
+func (a *Agent) unregisterAll(ctx context.Context) {
+	a.handlersMu.Lock()
+	registrations := make(map[string]grpcClient, len(a.registeredHandlers)+len(a.staleRegistrations))
+	for id := range a.registeredHandlers {
+		client, ok := a.registeredWith[id]
+		if !ok {
+			client = a.activeClient()
+		}
+		registrations[id] = client
+	}
+	for id, client := range a.staleRegistrations {
+		registrations[id] = client
+	}
+	clear(a.registeredHandlers)
+	clear(a.registeredWith)
+	clear(a.staleRegistrations)
+	a.handlersMu.Unlock()
+
+	for id, client := range registrations {
+		a.unregisterWith(ctx, client, id)
+	}
+}
+
+// abortInFlight cancels every running invocation, then reports them concurrently
+// with a single attempt each so Stop returns soon after its deadline
+func (a *Agent) abortInFlight() {
+	a.inFlightMu.Lock()
+	inFlight := make([]*invocation, 0, len(a.inFlight))
+	for inv := range a.inFlight {
+		inFlight = append(inFlight, inv)
+	}
+	a.inFlightMu.Unlock()
+
+	aborted := make(map[*invocation]*pb.ReportInvocationRequest, len(inFlight))
+	for _, inv := range inFlight {
+		if !inv.markReported() {
+			continue
+		}
+
+		a.logger.Warn("aborting handler on shutdown", zap.String("handler", inv.invoke.HandlerName))
+		inv.abort()
+		report := &pb.ReportInvocationRequest{
+			HandlerInvoke:        inv.invoke,
+			StartClientTimestamp: timestamppb.New(inv.start),
+			DurationMs:           int32(time.Since(inv.start).Milliseconds()),
+			Logs:                 inv.logs.freeze(),
+		}
+		a.setReportError(report, ErrorCodeShutdown, errAgentStopped)
+		a.finishInvocation(inv, report, false)
+		aborted[inv] = report
+	}
+
+	var reporting sync.WaitGroup
+	for inv, report := range aborted {
+		reporting.Add(1)
+		go func() {
+			defer reporting.Done()
+			ctx, cancel := context.WithTimeout(trace.ContextWithSpan(context.Background(), inv.span), abortReportTimeout)
+			defer cancel()
+			a.reportAborted(ctx, inv.client, report)
+		}()
+	}
+	reporting.Wait()
+}
+
+// reportAborted reports an aborted invocation with a single attempt
+func (a *Agent) reportAborted(ctx context.Context, client grpcClient, report *pb.ReportInvocationRequest) {
+	stub := client.agent()
+	if stub == nil {
+		a.logger.Error("failed to report aborted invocation, no agent connection")
+		return
+	}
+	if _, err := stub.ReportInvocation(ctx, report); err != nil {
+		a.logger.Error("failed to report aborted invocation", zap.Error(err))
+	}
+}
+
+// stopOnSignal calls Stop when one of the shutdown signals is received while
+// ctx is active.  The returned func stops listening for signals.
+func (a *Agent) stopOnSignal(ctx context.Context) func() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, a.shutdownSignals...)
+
+	go func() {
+		select {
+		case sig := <-signals:
+			a.logger.Info("received signal, shutting down", zap.String("signal", sig.String()))
+			stopCtx := context.Background()
+			if a.shutdownTimeout > 0 {
+				var cancel context.CancelFunc
+				stopCtx, cancel = context.WithTimeout(stopCtx, a.shutdownTimeout)
+				defer cancel()
+			}
+			if err := a.Stop(stopCtx); err != nil {
+				a.logger.Warn("handlers did not finish before the shutdown deadline", zap.Error(err))
+			}
+		case <-ctx.Done():
+		}
+	}()
+
+	return func() {
+		signal.Stop(signals)
+	}
+}
@@ -0,0 +1,197 @@
+package axon
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	pb "github.com/cortexapps/axon-go/.generated/proto/github.com/cortexapps/axon"
+	"github.com/cortexapps/axon-go/mock_axon"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func runStopHelper(t *testing.T, agent *Agent, mock *mockGrpcClient, handler Handler, reports chan *pb.ReportInvocationRequest) (started chan struct{}, runErr chan error) {
+	id := "stoppable"
+	stream := newBidiClient(&pb.DispatchMessage{
+		Type: pb.DispatchMessageType_DISPATCH_MESSAGE_INVOKE,
+		Message: &pb.DispatchMessage_Invoke{
+			Invoke: &pb.DispatchHandlerInvoke{
+				HandlerId:   id,
+				HandlerName: "stoppable",
+			},
+		},
+	})
+
+	mock.agentStub.EXPECT().RegisterHandler(gomock.Any(), gomock.Any()).Return(&pb.RegisterHandlerResponse{Id: id}, nil)
+	mock.agentStub.EXPECT().Dispatch(gomock.Any(), gomock.Any()).Return(stream, nil)
+	mock.agentStub.EXPECT().ReportInvocation(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, req *pb.ReportInvocationRequest, opts ...grpc.CallOption) (*pb.ReportInvocationResponse, error) {
+			reports <- req
+			return &pb.ReportInvocationResponse{}, nil
+		})
+
+	started = make(chan struct{})
+	_, err := agent.RegisterHandler(func(ctx HandlerContext) error {
+		close(started)
+		return handler(ctx)
+	}, WithName("stoppable"))
+	require.NoError(t, err)
+
+	runErr = make(chan error)
+	go func() {
+		runErr <- agent.Run(context.Background())
+	}()
+	return started, runErr
+}
+
+func TestStopDrainsRunningHandlers(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+	agent, mock := createAgent(controller)
+
+	reports := make(chan *pb.ReportInvocationRequest, 1)
+	started, runErr := runStopHelper(t, agent, mock, func(ctx HandlerContext) error {
+		time.Sleep(30 * time.Millisecond)
+		return nil
+	}, reports)
+
+	<-started
+	err := agent.Stop(context.Background())
+	require.NoError(t, err)
+	require.NoError(t, <-runErr)
+
+	report := <-reports
+	require.Nil(t, report.GetError())
+}
+
+func TestStopAbortsAfterDeadline(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+	agent, mock := createAgent(controller)
+
+	release := make(chan struct{})
+	defer close(release)
+
+	reports := make(chan *pb.ReportInvocationRequest, 1)
+	started, runErr := runStopHelper(t, agent, mock, func(ctx HandlerContext) error {
+		<-release
+		return nil
+	}, reports)
+
+	<-started
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	err := agent.Stop(ctx)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.NoError(t, <-runErr)
+
+	report := <-reports
+	require.Equal(t, ErrorCodeShutdown, report.GetError().GetCode())
+}
+
+func TestAbortInFlightCancelsThenReportsConcurrently(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+	agent, mock := createAgent(controller)
+
+	const count = 3
+	var cancelled atomic.Int32
+	for i := 0; i < count; i++ {
+		_, span := agent.startInvocationSpan(context.Background(), &pb.DispatchHandlerInvoke{HandlerName: "stuck"})
+		agent.trackInvocation(mock, &pb.DispatchHandlerInvoke{HandlerName: "stuck"}, span, func() {
+			cancelled.Add(1)
+		})
+	}
+
+	// every report is made once, after all the invocations were cancelled, and
+	// they are in progress together
+	arrived := make(chan struct{}, count)
+	mock.agentStub.EXPECT().ReportInvocation(gomock.Any(), gomock.Any(), gomock.Any()).Times(count).DoAndReturn(
+		func(ctx context.Context, req *pb.ReportInvocationRequest, opts ...grpc.CallOption) (*pb.ReportInvocationResponse, error) {
+			require.Equal(t, int32(count), cancelled.Load())
+			require.Equal(t, ErrorCodeShutdown, req.GetError().GetCode())
+			deadline, ok := ctx.Deadline()
+			require.True(t, ok)
+			require.LessOrEqual(t, time.Until(deadline), abortReportTimeout)
+
+			arrived <- struct{}{}
+			for len(arrived) < count {
+				select {
+				case <-ctx.Done():
+					return nil, status.Error(codes.DeadlineExceeded, "all reports did not start together")
+				case <-time.After(time.Millisecond):
+				}
+			}
+			return nil, status.Error(codes.Unavailable, "agent is down")
+		})
+
+	start := time.Now()
+	agent.abortInFlight()
+	require.Less(t, time.Since(start), abortReportTimeout)
+}
+
+func TestStopUnregistersHandlers(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+
+	agent := NewAxonAgent(WithSleepOnError(0), WithUnregisterOnStop())
+	mock := &mockGrpcClient{
+		apiStub:   mock_axon.NewMockCortexApiClient(controller),
+		agentStub: mock_axon.NewMockAxonAgentClient(controller),
+	}
+	agent.client = mock
+
+	mock.agentStub.EXPECT().RegisterHandler(gomock.Any(), gomock.Any()).Return(&pb.RegisterHandlerResponse{Id: "1"}, nil)
+	mock.agentStub.EXPECT().UnregisterHandler(gomock.Any(), &pb.UnregisterHandlerRequest{Id: "1"}).Return(&pb.UnregisterHandlerResponse{}, nil)
+
+	_, err := agent.RegisterHandler(syncHandler)
+	require.NoError(t, err)
+
+	require.NoError(t, agent.Stop(context.Background()))
+	require.Empty(t, agent.registeredHandlers)
+
+	// Run exits straight away once stopped
+	require.NoError(t, agent.Run(context.Background()))
+}
+
+func TestStopUnregisterHonorsDeadline(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+
+	agent := NewAxonAgent(WithSleepOnError(0), WithUnregisterOnStop())
+	mock := &mockGrpcClient{
+		apiStub:   mock_axon.NewMockCortexApiClient(controller),
+		agentStub: mock_axon.NewMockAxonAgentClient(controller),
+	}
+	agent.client = mock
+
+	mock.agentStub.EXPECT().RegisterHandler(gomock.Any(), gomock.Any()).Return(&pb.RegisterHandlerResponse{Id: "1"}, nil)
+	_, err := agent.RegisterHandler(syncHandler)
+	require.NoError(t, err)
+
+	// the agent is unreachable, so the call only ends with Stop's context, and
+	// handlers can be registered meanwhile
+	var lockFree bool
+	mock.agentStub.EXPECT().UnregisterHandler(gomock.Any(), &pb.UnregisterHandlerRequest{Id: "1"}).DoAndReturn(
+		func(ctx context.Context, req *pb.UnregisterHandlerRequest, opts ...grpc.CallOption) (*pb.UnregisterHandlerResponse, error) {
+			if agent.handlersMu.TryLock() {
+				lockFree = true
+				agent.handlersMu.Unlock()
+			}
+			<-ctx.Done()
+			return nil, ctx.Err()
+		})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	agent.Stop(ctx)
+	require.Less(t, time.Since(start), 5*time.Second)
+	require.True(t, lockFree)
+	require.Empty(t, agent.registeredHandlers)
+}
@@ -0,0 +1,204 @@
+package axon
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/credentials"
+)
+
+// TLSConfig configures TLS for the connection to the agent.  The certificate files
+// are re-read when they change on disk, so rotated certificates are picked up by
+// new connections without restarting.
+type TLSConfig struct {
+	// CAFile is a PEM bundle used to verify the agent's certificate, the system
+	// roots are used if empty
+	CAFile string
+	// CertFile and KeyFile are the PEM client certificate and key presented to
+	// the agent for mTLS
+	CertFile string
+	KeyFile  string
+	// ServerName overrides the name used to verify the agent's certificate,
+	// which defaults to the host being connected to
+	ServerName string
+}
+
+func (c *TLSConfig) validate() error {
+	if (c.CertFile == "") != (c.KeyFile == "") {
+		return errors.New("both CertFile and KeyFile must be set for mTLS")
+	}
+	return nil
+}
+
+// transportCredentials builds gRPC credentials from the config
+func (c *TLSConfig) transportCredentials() (credentials.TransportCredentials, error) {
+	if err := c.validate(); err != nil {
+		return nil, err
+	}
+
+	config := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ServerName: c.ServerName,
+	}
+
+	if c.CertFile != "" {
+		certs := &certReloader{certFile: c.CertFile, keyFile: c.KeyFile}
+		if _, err := certs.certificate(); err != nil {
+			return nil, err
+		}
+		config.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return certs.certificate()
+		}
+	}
+
+	if c.CAFile != "" {
+		roots := &caReloader{caFile: c.CAFile}
+		if _, err := roots.pool(); err != nil {
+			return nil, err
+		}
+		return &reloadingCredentials{
+			TransportCredentials: credentials.NewTLS(config),
+			config:               config,
+			roots:                roots,
+		}, nil
+	}
+
+	return credentials.NewTLS(config), nil
+}
+
+// reloadingCredentials verifies the agent's certificate against the current CA
+// bundle, building the standard TLS credentials for each handshake so the bundle
+// can be reloaded while keeping the standard verification of the name dialed
+type reloadingCredentials struct {
+	credentials.TransportCredentials
+	config *tls.Config
+	roots  *caReloader
+}
+
+func (c *reloadingCredentials) ClientHandshake(ctx context.Context, authority string, conn net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	pool, err := c.roots.pool()
+	if err != nil {
+		return nil, nil, err
+	}
+	config := c.config.Clone()
+	config.RootCAs = pool
+	return credentials.NewTLS(config).ClientHandshake(ctx, authority, conn)
+}
+
+func (c *reloadingCredentials) OverrideServerName(name string) error {
+	c.config.ServerName = name
+	return nil
+}
+
+func (c *reloadingCredentials) Clone() credentials.TransportCredentials {
+	config := c.config.Clone()
+	return &reloadingCredentials{
+		TransportCredentials: credentials.NewTLS(config),
+		config:               config,
+		roots:                c.roots,
+	}
+}
+
+// fileVersion identifies the contents of a file on disk
+type fileVersion struct {
+	modTime time.Time
+	size    int64
+}
+
+func statFile(path string) (fileVersion, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fileVersion{}, err
+	}
+	return fileVersion{modTime: info.ModTime(), size: info.Size()}, nil
+}
+
+// certReloader loads a certificate and key, reloading them when either file changes
+type certReloader struct {
+	certFile string
+	keyFile  string
+
+	mu          sync.Mutex
+	cert        *tls.Certificate
+	certVersion fileVersion
+	keyVersion  fileVersion
+}
+
+func (r *certReloader) certificate() (*tls.Certificate, error) {
+	certVersion, err := statFile(r.certFile)
+	if err != nil {
+		return nil, err
+	}
+	keyVersion, err := statFile(r.keyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.cert != nil && certVersion == r.certVersion && keyVersion == r.keyVersion {
+		return r.cert, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		if r.cert != nil {
+			// likely caught mid rotation, keep using the previous certificate
+			return r.cert, nil
+		}
+		return nil, fmt.Errorf("failed to load client certificate: %w", err)
+	}
+
+	r.cert = &cert
+	r.certVersion = certVersion
+	r.keyVersion = keyVersion
+	return r.cert, nil
+}
+
+// caReloader loads a CA bundle, reloading it when the file changes
+type caReloader struct {
+	caFile string
+
+	mu      sync.Mutex
+	roots   *x509.CertPool
+	version fileVersion
+}
+
+func (r *caReloader) pool() (*x509.CertPool, error) {
+	version, err := statFile(r.caFile)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.roots != nil && version == r.version {
+		return r.roots, nil
+	}
+
+	pem, err := os.ReadFile(r.caFile)
+	if err != nil {
+		return nil, err
+	}
+
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(pem) {
+		if r.roots != nil {
+			return r.roots, nil
+		}
+		return nil, fmt.Errorf("no certificates found in %s", r.caFile)
+	}
+
+	r.roots = roots
+	r.version = version
+	return r.roots, nil
+}
@@ -0,0 +1,244 @@
+package axon
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	pb "github.com/cortexapps/axon-go/.generated/proto/github.com/cortexapps/axon"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+)
+
+type testCert struct {
+	cert    *x509.Certificate
+	key     *ecdsa.PrivateKey
+	certPEM []byte
+	keyPEM  []byte
+}
+
+func newTestCert(t *testing.T, name string, parent *testCert, isCA bool) *testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		DNSNames:     []string{name},
+	}
+	if isCA {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage |= x509.KeyUsageCertSign
+	}
+
+	signer, signerKey := template, key
+	if parent != nil {
+		signer, signerKey = parent.cert, parent.key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	return &testCert{
+		cert:    cert,
+		key:     key,
+		certPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		keyPEM:  pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+	}
+}
+
+func (c *testCert) write(t *testing.T, dir string, name string, modTime time.Time) (certFile string, keyFile string) {
+	certFile = filepath.Join(dir, name+".crt")
+	keyFile = filepath.Join(dir, name+".key")
+	require.NoError(t, os.WriteFile(certFile, c.certPEM, 0600))
+	require.NoError(t, os.WriteFile(keyFile, c.keyPEM, 0600))
+	require.NoError(t, os.Chtimes(certFile, modTime, modTime))
+	require.NoError(t, os.Chtimes(keyFile, modTime, modTime))
+	return certFile, keyFile
+}
+
+type tlsTestServer struct {
+	pb.UnimplementedAxonAgentServer
+	clientNames chan string
+}
+
+func (s *tlsTestServer) ListHandlers(ctx context.Context, req *pb.ListHandlersRequest) (*pb.ListHandlersResponse, error) {
+	name := ""
+	if p, ok := peer.FromContext(ctx); ok {
+		if info, ok := p.AuthInfo.(credentials.TLSInfo); ok && len(info.State.PeerCertificates) > 0 {
+			name = info.State.PeerCertificates[0].Subject.CommonName
+		}
+	}
+	s.clientNames <- name
+	return &pb.ListHandlersResponse{}, nil
+}
+
+func startTLSServer(t *testing.T, ca *testCert, server *testCert) (int, *tlsTestServer) {
+	serverCert, err := tls.X509KeyPair(server.certPEM, server.keyPEM)
+	require.NoError(t, err)
+
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(ca.cert)
+
+	creds := credentials.NewTLS(&tls.Config{
+		Certificates: []tls.Certificate{serverCert},
+		ClientAuth:   tls.VerifyClientCertIfGiven,
+		ClientCAs:    clientCAs,
+	})
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	impl := &tlsTestServer{clientNames: make(chan string, 1)}
+	s := grpc.NewServer(grpc.Creds(creds))
+	pb.RegisterAxonAgentServer(s, impl)
+	go s.Serve(listener)
+	t.Cleanup(s.Stop)
+
+	return listener.Addr().(*net.TCPAddr).Port, impl
+}
+
+func TestTLSConnection(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCert(t, "test-ca", nil, true)
+	server := newTestCert(t, "axon-agent", ca, false)
+	client := newTestCert(t, "axon-client", ca, false)
+
+	caFile, _ := ca.write(t, dir, "ca", time.Now())
+	certFile, keyFile := client.write(t, dir, "client", time.Now())
+
+	port, impl := startTLSServer(t, ca, server)
+
+	t.Run("server TLS", func(t *testing.T) {
+		agent := NewAxonAgent(
+			WithHostport("127.0.0.1", port),
+			WithTLS(TLSConfig{CAFile: caFile, ServerName: "axon-agent"}),
+		)
+		_, err := agent.client.agent().ListHandlers(context.Background(), &pb.ListHandlersRequest{})
+		require.NoError(t, err)
+		require.Equal(t, "", <-impl.clientNames)
+	})
+
+	t.Run("mTLS", func(t *testing.T) {
+		agent := NewAxonAgent(
+			WithHostport("127.0.0.1", port),
+			WithTLS(TLSConfig{CAFile: caFile, CertFile: certFile, KeyFile: keyFile, ServerName: "axon-agent"}),
+		)
+		_, err := agent.client.agent().ListHandlers(context.Background(), &pb.ListHandlersRequest{})
+		require.NoError(t, err)
+		require.Equal(t, "axon-client", <-impl.clientNames)
+	})
+
+	t.Run("wrong server name", func(t *testing.T) {
+		agent := NewAxonAgent(
+			WithHostport("127.0.0.1", port),
+			WithTLS(TLSConfig{CAFile: caFile, ServerName: "someone-else"}),
+		)
+		_, err := agent.client.agent().ListHandlers(context.Background(), &pb.ListHandlersRequest{})
+		require.Error(t, err)
+	})
+
+	t.Run("ip target without server name", func(t *testing.T) {
+		// the certificate is only valid for axon-agent, not the address dialed
+		agent := NewAxonAgent(
+			WithHostport("127.0.0.1", port),
+			WithTLS(TLSConfig{CAFile: caFile}),
+		)
+		_, err := agent.client.agent().ListHandlers(context.Background(), &pb.ListHandlersRequest{})
+		require.ErrorContains(t, err, "x509: cannot validate certificate for 127.0.0.1")
+	})
+
+	t.Run("untrusted server", func(t *testing.T) {
+		otherCA := newTestCert(t, "other-ca", nil, true)
+		otherCAFile, _ := otherCA.write(t, dir, "other-ca", time.Now())
+		agent := NewAxonAgent(
+			WithHostport("127.0.0.1", port),
+			WithTLS(TLSConfig{CAFile: otherCAFile, ServerName: "axon-agent"}),
+		)
+		_, err := agent.client.agent().ListHandlers(context.Background(), &pb.ListHandlersRequest{})
+		require.Error(t, err)
+	})
+}
+
+func TestTLSConfigValidation(t *testing.T) {
+	_, err := (&TLSConfig{CertFile: "client.crt"}).transportCredentials()
+	require.ErrorContains(t, err, "KeyFile")
+
+	_, err = (&TLSConfig{CAFile: filepath.Join(t.TempDir(), "missing.pem")}).transportCredentials()
+	require.Error(t, err)
+}
+
+func TestCertificateReload(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCert(t, "test-ca", nil, true)
+	first := newTestCert(t, "first", ca, false)
+	second := newTestCert(t, "second", ca, false)
+
+	certFile, keyFile := first.write(t, dir, "client", time.Now().Add(-time.Minute))
+	reloader := &certReloader{certFile: certFile, keyFile: keyFile}
+
+	cert, err := reloader.certificate()
+	require.NoError(t, err)
+	require.Equal(t, first.cert.Raw, cert.Certificate[0])
+
+	second.write(t, dir, "client", time.Now())
+	cert, err = reloader.certificate()
+	require.NoError(t, err)
+	require.Equal(t, second.cert.Raw, cert.Certificate[0])
+
+	// a half written rotation keeps the previous certificate
+	require.NoError(t, os.WriteFile(keyFile, []byte("garbage"), 0600))
+	cert, err = reloader.certificate()
+	require.NoError(t, err)
+	require.Equal(t, second.cert.Raw, cert.Certificate[0])
+}
+
+func TestCAReload(t *testing.T) {
+	dir := t.TempDir()
+	first := newTestCert(t, "first-ca", nil, true)
+	second := newTestCert(t, "second-ca", nil, true)
+
+	caFile, _ := first.write(t, dir, "ca", time.Now().Add(-time.Minute))
+	reloader := &caReloader{caFile: caFile}
+
+	server := newTestCert(t, "axon-agent", second, false)
+	verify := func(pool *x509.CertPool) error {
+		_, err := server.cert.Verify(x509.VerifyOptions{DNSName: "axon-agent", Roots: pool})
+		return err
+	}
+
+	pool, err := reloader.pool()
+	require.NoError(t, err)
+	require.Error(t, verify(pool))
+
+	second.write(t, dir, "ca", time.Now())
+	pool, err = reloader.pool()
+	require.NoError(t, err)
+	require.NoError(t, verify(pool))
+}
@@ -0,0 +1,124 @@
+package axon
+
+import (
+	"context"
+	"fmt"
+
+	pb "github.com/cortexapps/axon-go/.generated/proto/github.com/cortexapps/axon"
+	"github.com/cortexapps/axon-go/version"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+const tracerName = "github.com/cortexapps/axon-go"
+
+// span attribute keys
+const (
+	attrInvocationId = attribute.Key("axon.invocation_id")
+	attrDispatchId   = attribute.Key("axon.dispatch_id")
+	attrHandlerName  = attribute.Key("axon.handler.name")
+	attrInvokeReason = attribute.Key("axon.invoke.reason")
+	attrErrorCode    = attribute.Key("axon.error.code")
+	attrHTTPMethod   = attribute.Key("http.request.method")
+	attrHTTPStatus   = attribute.Key("http.response.status_code")
+	attrURLPath      = attribute.Key("url.path")
+)
+
+func newTracer(provider trace.TracerProvider) trace.Tracer {
+	return provider.Tracer(tracerName, trace.WithInstrumentationVersion(version.Client))
+}
+
+// startInvocationSpan starts the span covering an invocation, from when it is
+// granted a concurrency slot until it is reported
+func (a *Agent) startInvocationSpan(ctx context.Context, invoke *pb.DispatchHandlerInvoke) (context.Context, trace.Span) {
+	return a.tracer.Start(ctx, "axon.invoke "+invoke.HandlerName,
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(
+			attrInvocationId.String(invoke.InvocationId),
+			attrDispatchId.String(invoke.DispatchId),
+			attrHandlerName.String(invoke.HandlerName),
+			attrInvokeReason.String(invoke.Reason.String()),
+		),
+	)
+}
+
+// endInvocationSpan ends the span with the outcome of the report
+func endInvocationSpan(span trace.Span, report *pb.ReportInvocationRequest) {
+	if e := report.GetError(); e != nil {
+		span.SetAttributes(attrErrorCode.String(e.Code))
+		span.SetStatus(codes.Error, e.Message)
+	}
+	span.End()
+}
+
+// tracingApiClient starts a span for every Cortex API call made by a handler
+type tracingApiClient struct {
+	pb.CortexApiClient
+	tracer trace.Tracer
+}
+
+func (c *tracingApiClient) Call(ctx context.Context, in *pb.CallRequest, opts ...grpc.CallOption) (*pb.CallResponse, error) {
+	ctx, span := c.tracer.Start(ctx, fmt.Sprintf("cortex.api %s %s", in.Method, in.Path),
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attrHTTPMethod.String(in.Method),
+			attrURLPath.String(in.Path),
+		),
+	)
+	defer span.End()
+
+	res, err := c.CortexApiClient.Call(ctx, in, opts...)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return res, err
+	}
+
+	span.SetAttributes(attrHTTPStatus.Int(int(res.StatusCode)))
+	if res.StatusCode >= 400 {
+		span.SetStatus(codes.Error, res.Status)
+	}
+	return res, nil
+}
+
+// propagationInterceptor injects the trace context of the call into the outgoing
+// gRPC metadata, so the agent can continue the trace
+func propagationInterceptor(propagator propagation.TextMapPropagator) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		md, ok := metadata.FromOutgoingContext(ctx)
+		if ok {
+			md = md.Copy()
+		} else {
+			md = metadata.MD{}
+		}
+		propagator.Inject(ctx, metadataCarrier(md))
+		return invoker(metadata.NewOutgoingContext(ctx, md), method, req, reply, cc, opts...)
+	}
+}
+
+// metadataCarrier adapts gRPC metadata to a propagation.TextMapCarrier
+type metadataCarrier metadata.MD
+
+func (c metadataCarrier) Get(key string) string {
+	values := metadata.MD(c).Get(key)
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+func (c metadataCarrier) Set(key string, value string) {
+	metadata.MD(c).Set(key, value)
+}
+
+func (c metadataCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for key := range c {
+		keys = append(keys, key)
+	}
+	return keys
+}
@@ -0,0 +1,130 @@
+package axon
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	pb "github.com/cortexapps/axon-go/.generated/proto/github.com/cortexapps/axon"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/mock/gomock"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+func spanAttributes(span sdktrace.ReadOnlySpan) map[attribute.Key]attribute.Value {
+	attrs := map[attribute.Key]attribute.Value{}
+	for _, kv := range span.Attributes() {
+		attrs[kv.Key] = kv.Value
+	}
+	return attrs
+}
+
+func runTracingHelper(t *testing.T, handler InvocableHandler, callResponse *pb.CallResponse) ([]sdktrace.ReadOnlySpan, trace.SpanContext) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+	agent, mock := createAgent(controller)
+
+	recorder := tracetest.NewSpanRecorder()
+	agent.tracer = newTracer(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+
+	mock.agentStub.EXPECT().RegisterHandler(gomock.Any(), gomock.Any()).Return(&pb.RegisterHandlerResponse{Id: "1"}, nil)
+	_, err := agent.RegisterInvocableHandler(handler, WithName("syncHandler"))
+	require.NoError(t, err)
+
+	if callResponse != nil {
+		mock.apiStub.EXPECT().Call(gomock.Any(), gomock.Any()).Return(callResponse, nil)
+	}
+
+	var reportSpan trace.SpanContext
+	mock.agentStub.EXPECT().Dispatch(gomock.Any(), gomock.Any()).Return(workCompletedStream(invokeMessage("1", "inv-1")), nil)
+	mock.agentStub.EXPECT().ReportInvocation(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, req *pb.ReportInvocationRequest, opts ...grpc.CallOption) (*pb.ReportInvocationResponse, error) {
+			reportSpan = trace.SpanContextFromContext(ctx)
+			return &pb.ReportInvocationResponse{}, nil
+		})
+
+	require.NoError(t, agent.Run(context.Background()))
+	return recorder.Ended(), reportSpan
+}
+
+func TestInvocationSpan(t *testing.T) {
+	var handlerSpan trace.SpanContext
+	spans, reportSpan := runTracingHelper(t, func(ctx HandlerContext) (any, error) {
+		handlerSpan = trace.SpanContextFromContext(ctx)
+		_, err := ctx.CortexJsonApiCall("GET", "/api/v1/catalog", "")
+		return nil, err
+	}, &pb.CallResponse{StatusCode: 200, Status: "200 OK"})
+
+	require.Len(t, spans, 2)
+	call, invoke := spans[0], spans[1]
+
+	require.Equal(t, "axon.invoke syncHandler", invoke.Name())
+	require.Equal(t, trace.SpanKindConsumer, invoke.SpanKind())
+	require.Equal(t, codes.Unset, invoke.Status().Code)
+	attrs := spanAttributes(invoke)
+	require.Equal(t, "inv-1", attrs[attrInvocationId].AsString())
+	require.Equal(t, "syncHandler", attrs[attrHandlerName].AsString())
+	require.Equal(t, "INVOKE", attrs[attrInvokeReason].AsString())
+
+	// the handler runs within the invocation span, which is reported to the agent
+	require.Equal(t, invoke.SpanContext(), handlerSpan)
+	require.Equal(t, invoke.SpanContext(), reportSpan)
+
+	require.Equal(t, "cortex.api GET /api/v1/catalog", call.Name())
+	require.Equal(t, trace.SpanKindClient, call.SpanKind())
+	require.Equal(t, invoke.SpanContext().SpanID(), call.Parent().SpanID())
+	attrs = spanAttributes(call)
+	require.Equal(t, "GET", attrs[attrHTTPMethod].AsString())
+	require.Equal(t, "/api/v1/catalog", attrs[attrURLPath].AsString())
+	require.Equal(t, int64(200), attrs[attrHTTPStatus].AsInt64())
+	require.Equal(t, codes.Unset, call.Status().Code)
+}
+
+func TestInvocationSpanErrors(t *testing.T) {
+	spans, _ := runTracingHelper(t, func(ctx HandlerContext) (any, error) {
+		res, err := ctx.CortexJsonApiCall("GET", "/api/v1/catalog/missing", "")
+		if err != nil {
+			return nil, err
+		}
+		return nil, NewHandlerError("not_found", errors.New(res.Status))
+	}, &pb.CallResponse{StatusCode: 404, Status: "404 Not Found"})
+
+	require.Len(t, spans, 2)
+	call, invoke := spans[0], spans[1]
+
+	require.Equal(t, codes.Error, call.Status().Code)
+	require.Equal(t, "404 Not Found", call.Status().Description)
+
+	require.Equal(t, codes.Error, invoke.Status().Code)
+	require.Equal(t, "not_found", spanAttributes(invoke)[attrErrorCode].AsString())
+}
+
+func TestPropagationInterceptor(t *testing.T) {
+	provider := sdktrace.NewTracerProvider()
+	ctx, span := provider.Tracer("test").Start(context.Background(), "test")
+	defer span.End()
+	ctx = metadata.AppendToOutgoingContext(ctx, "existing", "value")
+
+	var md metadata.MD
+	interceptor := propagationInterceptor(propagation.TraceContext{})
+	err := interceptor(ctx, "/method", nil, nil, nil, func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		md, _ = metadata.FromOutgoingContext(ctx)
+		return nil
+	})
+	require.NoError(t, err)
+
+	require.Equal(t, []string{"value"}, md.Get("existing"))
+	require.Len(t, md.Get("traceparent"), 1)
+	require.Contains(t, md.Get("traceparent")[0], span.SpanContext().TraceID().String())
+
+	// the trace context can be read back from the metadata
+	extracted := propagation.TraceContext{}.Extract(context.Background(), metadataCarrier(md))
+	require.Equal(t, span.SpanContext().TraceID(), trace.SpanContextFromContext(extracted).TraceID())
+}
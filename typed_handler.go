@@ -0,0 +1,236 @@
+package axon
+
+import (
+	"encoding"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TypedHandler is a handler that receives the invocation args decoded into In
+// and returns a result of type Out.  See DecodeArgs for how args are mapped onto In.
+type TypedHandler[In any, Out any] func(HandlerContext, In) (Out, error)
+
+// Validator can be implemented by a TypedHandler argument type to validate the
+// decoded args before the handler is called
+type Validator interface {
+	Validate() error
+}
+
+// RegisterTypedHandler registers a TypedHandler with the agent.  The invocation args are
+// decoded into In and validated before the handler is called, and the returned Out
+// is encoded into the invocation result by the agent's ResultEncoder.  Decoding and
+// validation failures are reported with the ErrorCodeInvalidArgs code.  In must be a
+// struct, a pointer to a struct or map[string]string.
+func RegisterTypedHandler[In any, Out any](a *Agent, handler TypedHandler[In, Out], invokeOptions ...RegisterHandlerOption) (string, error) {
+	if err := checkArgType(reflect.TypeFor[In]()); err != nil {
+		return "", err
+	}
+	return a.registerInvocableHandler(handler, handler.invocable(), invokeOptions...)
+}
+
+// checkArgType returns an error if args cannot be decoded into t
+func checkArgType(t reflect.Type) error {
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Kind() == reflect.Struct || t == reflect.TypeOf(map[string]string{}) {
+		return nil
+	}
+	return fmt.Errorf("unsupported handler argument type: %s", t)
+}
+
+// invocable returns an InvocableHandler decoding the args into In before calling h
+func (h TypedHandler[In, Out]) invocable() InvocableHandler {
+	return func(ctx HandlerContext) (any, error) {
+		var in In
+		if err := decodeTypedArgs(ctx.Args(), &in); err != nil {
+			return nil, err
+		}
+
+		return h(ctx, in)
+	}
+}
+
+func decodeTypedArgs(args map[string]string, target any) error {
+
+	v := reflect.ValueOf(target).Elem()
+
+	// allow pointer argument types, e.g. TypedHandler[*MyArgs, string]
+	if v.Kind() == reflect.Pointer {
+		v.Set(reflect.New(v.Type().Elem()))
+		target = v.Interface()
+		v = v.Elem()
+	}
+
+	switch {
+	case v.Kind() == reflect.Struct:
+		if err := DecodeArgs(args, target); err != nil {
+			return err
+		}
+	case v.Type() == reflect.TypeOf(map[string]string{}):
+		m := make(map[string]string, len(args))
+		for k, val := range args {
+			m[k] = val
+		}
+		v.Set(reflect.ValueOf(m))
+	default:
+		return fmt.Errorf("unsupported handler argument type: %s", v.Type())
+	}
+
+	if validator, ok := target.(Validator); ok {
+		if err := validator.Validate(); err != nil {
+			return NewHandlerError(ErrorCodeInvalidArgs, err)
+		}
+	}
+	return nil
+}
+
+// DecodeArgs decodes invocation args into the struct pointed to by target.
+//
+// Fields are matched using the `axon` struct tag, falling back to the field name,
+// and a tag of "-" skips the field.  The tag supports a "required" option, e.g.
+// `axon:"entity,required"`, and a `default` tag supplies the value for missing args.
+//
+// Supported field types are strings, bools, ints, uints, floats, time.Duration,
+// encoding.TextUnmarshaler implementations, pointers to those and slices of
+// those which are read as comma separated values.
+func DecodeArgs(args map[string]string, target any) error {
+	v := reflect.ValueOf(target)
+	if v.Kind() != reflect.Pointer || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("decode target must be a non-nil pointer to a struct, got %T", target)
+	}
+	return decodeStruct(args, v.Elem())
+}
+
+func decodeStruct(args map[string]string, v reflect.Value) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		tag := field.Tag.Get("axon")
+		if tag == "-" {
+			continue
+		}
+
+		if field.Anonymous && tag == "" && field.Type.Kind() == reflect.Struct {
+			if err := decodeStruct(args, v.Field(i)); err != nil {
+				return err
+			}
+			continue
+		}
+
+		name, required := parseArgTag(field.Name, tag)
+
+		value, ok := args[name]
+		if !ok {
+			value, ok = field.Tag.Lookup("default")
+		}
+
+		if !ok {
+			if required {
+				return invalidArgsError("missing required arg %q", name)
+			}
+			continue
+		}
+
+		if err := setArgValue(v.Field(i), value); err != nil {
+			return invalidArgsError("invalid value for arg %q: %v", name, err)
+		}
+	}
+	return nil
+}
+
+func parseArgTag(fieldName string, tag string) (name string, required bool) {
+	parts := strings.Split(tag, ",")
+	name = parts[0]
+	if name == "" {
+		name = fieldName
+	}
+	for _, opt := range parts[1:] {
+		if strings.TrimSpace(opt) == "required" {
+			required = true
+		}
+	}
+	return name, required
+}
+
+var (
+	durationType        = reflect.TypeOf(time.Duration(0))
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+func setArgValue(v reflect.Value, value string) error {
+
+	if v.Kind() == reflect.Pointer {
+		ptr := reflect.New(v.Type().Elem())
+		if err := setArgValue(ptr.Elem(), value); err != nil {
+			return err
+		}
+		v.Set(ptr)
+		return nil
+	}
+
+	if reflect.PointerTo(v.Type()).Implements(textUnmarshalerType) {
+		return v.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(value))
+	}
+
+	if v.Type() == durationType {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(value, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(value, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	case reflect.Slice:
+		if value == "" {
+			v.Set(reflect.MakeSlice(v.Type(), 0, 0))
+			return nil
+		}
+		parts := strings.Split(value, ",")
+		slice := reflect.MakeSlice(v.Type(), len(parts), len(parts))
+		for i, part := range parts {
+			if err := setArgValue(slice.Index(i), strings.TrimSpace(part)); err != nil {
+				return err
+			}
+		}
+		v.Set(slice)
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+	return nil
+}
@@ -0,0 +1,146 @@
+package axon
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	pb "github.com/cortexapps/axon-go/.generated/proto/github.com/cortexapps/axon"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+	"go.uber.org/zap"
+)
+
+type testArgs struct {
+	Entity  string        `axon:"entity,required"`
+	Count   int           `axon:"count" default:"10"`
+	Enabled bool          `axon:"enabled"`
+	Wait    time.Duration `axon:"wait"`
+	Tags    []string      `axon:"tags"`
+	Ratio   *float64      `axon:"ratio"`
+	Ignored string        `axon:"-"`
+}
+
+func (a testArgs) Validate() error {
+	if a.Count < 0 {
+		return errors.New("count must be positive")
+	}
+	return nil
+}
+
+type testResult struct {
+	Entity string `json:"entity"`
+	Count  int    `json:"count"`
+}
+
+func TestDecodeArgs(t *testing.T) {
+	args := testArgs{}
+	err := DecodeArgs(map[string]string{
+		"entity":  "my-service",
+		"enabled": "true",
+		"wait":    "5s",
+		"tags":    "a, b,c",
+		"ratio":   "0.5",
+		"Ignored": "nope",
+	}, &args)
+	require.NoError(t, err)
+
+	require.Equal(t, "my-service", args.Entity)
+	require.Equal(t, 10, args.Count)
+	require.True(t, args.Enabled)
+	require.Equal(t, 5*time.Second, args.Wait)
+	require.Equal(t, []string{"a", "b", "c"}, args.Tags)
+	require.NotNil(t, args.Ratio)
+	require.Equal(t, 0.5, *args.Ratio)
+	require.Empty(t, args.Ignored)
+}
+
+func TestDecodeArgsErrors(t *testing.T) {
+	err := DecodeArgs(map[string]string{}, &testArgs{})
+	require.Error(t, err)
+	require.Equal(t, ErrorCodeInvalidArgs, errorCode(err))
+
+	err = DecodeArgs(map[string]string{"entity": "e", "count": "abc"}, &testArgs{})
+	require.Error(t, err)
+	require.Equal(t, ErrorCodeInvalidArgs, errorCode(err))
+
+	err = DecodeArgs(map[string]string{}, testArgs{})
+	require.Error(t, err)
+}
+
+func TestTypedHandler(t *testing.T) {
+
+	handler := func(ctx HandlerContext, args testArgs) (testResult, error) {
+		return testResult{Entity: args.Entity, Count: args.Count}, nil
+	}
+
+	result, err := invokeTypedHandlerHelper(t, handler, map[string]string{"entity": "my-service", "count": "3"})
+	require.NoError(t, err)
+	require.Equal(t, testResult{Entity: "my-service", Count: 3}, result)
+
+	_, err = invokeTypedHandlerHelper(t, handler, map[string]string{"count": "3"})
+	require.Error(t, err)
+	require.Equal(t, ErrorCodeInvalidArgs, errorCode(err))
+
+	_, err = invokeTypedHandlerHelper(t, handler, map[string]string{"entity": "my-service", "count": "-1"})
+	require.Error(t, err)
+	require.Equal(t, ErrorCodeInvalidArgs, errorCode(err))
+}
+
+func TestTypedHandlerPointerArgs(t *testing.T) {
+
+	handler := func(ctx HandlerContext, args *testArgs) (string, error) {
+		return args.Entity, nil
+	}
+
+	result, err := invokeTypedHandlerHelper(t, handler, map[string]string{"entity": "my-service"})
+	require.NoError(t, err)
+	require.Equal(t, "my-service", result)
+}
+
+func TestTypedHandlerMapArgs(t *testing.T) {
+
+	handler := func(ctx HandlerContext, args map[string]string) (*testResult, error) {
+		return nil, nil
+	}
+
+	result, err := invokeTypedHandlerHelper(t, handler, map[string]string{"entity": "my-service"})
+	require.NoError(t, err)
+	require.True(t, isNilResult(result))
+}
+
+func TestTypedHandlerUnsupportedArgs(t *testing.T) {
+	agent := NewAxonAgent()
+
+	// no registration is attempted for an argument type args can't be decoded into
+	_, err := RegisterTypedHandler(agent, func(ctx HandlerContext, args []string) (string, error) {
+		return "", nil
+	})
+	require.EqualError(t, err, "unsupported handler argument type: []string")
+
+	_, err = RegisterTypedHandler(agent, func(ctx HandlerContext, args *int) (string, error) {
+		return "", nil
+	})
+	require.EqualError(t, err, "unsupported handler argument type: int")
+	require.Empty(t, agent.handlers)
+}
+
+func invokeTypedHandlerHelper[In any, Out any](t *testing.T, handler TypedHandler[In, Out], args map[string]string) (any, error) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+	agent, mock := createAgent(controller)
+
+	mock.agentStub.EXPECT().RegisterHandler(gomock.Any(), gomock.Any()).Return(&pb.RegisterHandlerResponse{Id: "typed"}, nil)
+
+	id, err := RegisterTypedHandler(agent, handler)
+	require.NoError(t, err)
+
+	invoke := &pb.DispatchHandlerInvoke{
+		HandlerId: id,
+		Args:      args,
+	}
+	ctx := NewHandlerContext(invoke, context.Background(), mock.apiStub, zap.NewNop())
+	result, _, err := agent.executeHandlerWithRecover(agent.registeredHandlers[id], ctx)
+	return result, err
+}